@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+func (app *Application) createPersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	var input struct {
+		Name          string           `json:"name"`
+		Permissions   data.Permissions `json:"permissions"`
+		ExpiresInDays int              `json:"expires_in_days"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = 90
+	}
+
+	v := validator.New()
+
+	data.ValidatePersonalAccessTokenInput(v, input.Name, input.Permissions)
+	v.Check(input.ExpiresInDays > 0, "expires_in_days", "expires_in_days must be greater than zero")
+	v.Check(input.ExpiresInDays <= 365, "expires_in_days", "expires_in_days must not exceed 365")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.Models.Tokens.NewPersonalAccessToken(
+		user.ID,
+		time.Duration(input.ExpiresInDays)*24*time.Hour,
+		input.Name,
+		input.Permissions,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	pat := data.PersonalAccessToken{
+		ID:          token.ID,
+		Name:        token.Name,
+		Permissions: token.Permissions,
+		CreatedAt:   token.CreatedAt,
+		LastUsedAt:  token.CreatedAt,
+		ExpiredAt:   token.ExpiredAt,
+	}
+
+	// The plain text token is only ever shown in this response
+	err = app.writeJSON(w, http.StatusCreated, envelope{"token": token, "personal_access_token": pat}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) listPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	tokens, err := app.Models.Tokens.GetPersonalAccessTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"personal_access_tokens": tokens}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deletePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	ID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || ID < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	err = app.Models.Tokens.DeletePersonalAccessToken(user.ID, ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "personal access token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+func (app *Application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID != 0, "user_id", "user_id is required")
+	v.Check(input.UserID != user.ID, "user_id", "must not be own user_id")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	block, err := app.Models.Blocks.Insert(user.ID, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyBlocked):
+			app.badRequestErrorResponse(w, r, err)
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"block": block}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil || userID < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	err = app.Models.Blocks.Delete(app.getContextUser(r).ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user unblocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) listBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	var filter data.Filter
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter.Page = app.readInt(qs, "page", 1, v)
+	filter.PageSize = app.readInt(qs, "pageSize", 50, v)
+
+	if data.ValidateFilters(v, filter); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.Models.Blocks.GetBlocked(app.getContextUser(r).ID, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"_metadata": metadata, "blocks": users}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -34,6 +34,10 @@ func (app *Application) addCommentHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if _, ok := app.getVisiblePost(w, r, input.PostID); !ok {
+		return
+	}
+
 	comment := data.Comment{
 		PostID:  input.PostID,
 		UserID:  user.ID,
@@ -87,6 +91,10 @@ func (app *Application) getCommentByIDHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if _, ok := app.getVisiblePost(w, r, comment.PostID); !ok {
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -125,18 +133,11 @@ func (app *Application) getCommentsByPostHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	_, err := app.Models.Posts.Get(postID)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrNoRecordFound):
-			app.notFoundErrorResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+	if _, ok := app.getVisiblePost(w, r, postID); !ok {
 		return
 	}
 
-	comments, metadata, err := app.Models.Comments.GetCommentsByPost(input.PostID, input.Filter)
+	comments, metadata, err := app.Models.Comments.GetCommentsByPost(input.PostID, app.getContextUser(r).ID, input.Filter)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
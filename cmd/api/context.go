@@ -9,7 +9,11 @@ import (
 
 type contextKey string
 
-const useContextKey = contextKey("user")
+const (
+	useContextKey         = contextKey("user")
+	tokenContextKey       = contextKey("token")
+	permissionsContextKey = contextKey("permissions")
+)
 
 func (app *Application) setContextUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), useContextKey, user)
@@ -25,3 +29,33 @@ func (app *Application) getContextUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *Application) setContextToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+
+	return r.WithContext(ctx)
+}
+
+func (app *Application) getContextToken(r *http.Request) string {
+	token, ok := r.Context().Value(tokenContextKey).(string)
+	if !ok {
+		panic("missing token value in request context")
+	}
+
+	return token
+}
+
+func (app *Application) setContextPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+
+	return r.WithContext(ctx)
+}
+
+func (app *Application) getContextPermissions(r *http.Request) data.Permissions {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	if !ok {
+		panic("missing permissions value in request context")
+	}
+
+	return permissions
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+func (app *Application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	v.Check(input.Password != "", "password", "password is required")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password) {
+		return
+	}
+
+	if strings.EqualFold(input.Email, user.Email) {
+		v.AddError("email", "this is already your email")
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	// The unique constraint is checked again when the change is confirmed,
+	// this just saves mailing a token that could never be used
+	_, err = app.Models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email already exists")
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrNoRecordFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Users.SetPendingEmail(user.ID, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Only the most recently requested address can be confirmed
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.Models.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		verifyData := map[string]any{
+			"firstName":        user.FirstName,
+			"emailChangeToken": token.PlainText,
+		}
+
+		err := app.Mailer.Send(input.Email, "email_change_verify.tmpl", verifyData)
+		if err != nil {
+			app.Logger.PrintError(err.Error(), nil)
+		}
+
+		noticeData := map[string]any{
+			"firstName": user.FirstName,
+			"newEmail":  input.Email,
+		}
+
+		err = app.Mailer.Send(user.Email, "email_change_notice.tmpl", noticeData)
+		if err != nil {
+			app.Logger.PrintError(err.Error(), nil)
+		}
+	})
+
+	env := envelope{"message": "a confirmation email will be sent to the new address"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Tokens.GetForToken(data.ScopeEmailChange, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.validationErrorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Users.ConfirmPendingEmail(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.validationErrorResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists")
+			app.validationErrorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Self()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
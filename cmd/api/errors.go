@@ -1,7 +1,10 @@
 package api
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *Application) logError(r *http.Request, err error) {
@@ -96,6 +99,14 @@ func (app *Application) authorizationRequiredResponse(
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *Application) inactiveAccountResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (app *Application) editConflictResponse(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -103,3 +114,37 @@ func (app *Application) editConflictResponse(
 	message := "unable to edit record due to an edit conflict, please try again later"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+func (app *Application) versionRequiredResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	message := "the version you last read is required, send it as version or in an If-Match header"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *Application) privateAccountResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	message := "this account is private, follow it to see its content"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) notPermittedResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) loginLockedResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	retryAfter time.Duration,
+) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
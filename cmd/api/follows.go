@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/kharljhon14/starbloom-server/internal/data"
 	"github.com/kharljhon14/starbloom-server/internal/validator"
@@ -30,6 +31,49 @@ func (app *Application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	target, err := app.Models.Users.GetByID(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	blocked, err := app.Models.Blocks.Between(target.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if blocked {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// Private accounts approve their followers, so following one only
+	// requests it
+	if target.IsPrivate {
+		request, err := app.Models.FollowRequests.Insert(target.ID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrAlreadyFollowing), errors.Is(err, data.ErrAlreadyRequested):
+				app.badRequestErrorResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"follow_request": request}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	follow, err := app.Models.Follows.Insert(input.UserID, user.ID)
 	if err != nil {
 		switch {
@@ -71,6 +115,11 @@ func (app *Application) unFollowUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	err = app.Models.Follows.Delete(input.UserID, user.ID)
+	if errors.Is(err, data.ErrNoRecordFound) {
+		// Unfollowing a private account that hasn't approved the follow
+		// yet withdraws the request
+		err = app.Models.FollowRequests.Delete(input.UserID, user.ID)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
@@ -85,6 +134,24 @@ func (app *Application) unFollowUserHandler(w http.ResponseWriter, r *http.Reque
 }
 
 func (app *Application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowUsers(w, r, app.Models.Follows.GetFollowers)
+}
+
+func (app *Application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowUsers(w, r, app.Models.Follows.GetFollowing)
+}
+
+func (app *Application) getMutualsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowUsers(w, r, app.Models.Follows.GetMutuals)
+}
+
+// listFollowUsers serves a paginated list of the users connected to the
+// userID in the query string, as chosen by list.
+func (app *Application) listFollowUsers(
+	w http.ResponseWriter,
+	r *http.Request,
+	list func(userID, viewerID int64, filters data.Filter) ([]*data.FollowUser, data.Metadata, error),
+) {
 	var input struct {
 		UserID int64 `json:"user_id"`
 		data.Filter
@@ -108,7 +175,11 @@ func (app *Application) getFollowersHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	users, metadata, err := app.Models.Follows.GetFollowers(input.UserID, input.Filter)
+	if !app.requireVisibleUser(w, r, input.UserID) {
+		return
+	}
+
+	users, metadata, err := list(input.UserID, app.getContextUser(r).ID, input.Filter)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -119,3 +190,78 @@ func (app *Application) getFollowersHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *Application) listFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	var filter data.Filter
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter.Page = app.readInt(qs, "page", 1, v)
+	filter.PageSize = app.readInt(qs, "pageSize", 50, v)
+
+	if data.ValidateFilters(v, filter); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	requests, metadata, err := app.Models.FollowRequests.GetForUser(app.getContextUser(r).ID, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"_metadata": metadata, "follow_requests": requests}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := strconv.ParseInt(r.PathValue("requesterID"), 10, 64)
+	if err != nil || requesterID < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	follow, err := app.Models.FollowRequests.Approve(app.getContextUser(r).ID, requesterID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"follow": follow}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := strconv.ParseInt(r.PathValue("requesterID"), 10, 64)
+	if err != nil || requesterID < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	err = app.Models.FollowRequests.Delete(app.getContextUser(r).ID, requesterID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "follow request rejected"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
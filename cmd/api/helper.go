@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
@@ -15,6 +17,116 @@ import (
 
 type envelope map[string]interface{}
 
+// background runs fn in a goroutine tracked by the application wait group,
+// recovering any panic so it can't bring the server down.
+func (app *Application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.Logger.PrintError(fmt.Sprintf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// clientIP returns the address of the client that made the request. For
+// requests relayed by a trusted proxy it is the rightmost X-Forwarded-For
+// address that isn't itself a trusted proxy, as anything further left was
+// written by the client. Otherwise it is the remote address without its
+// port, which behind an untrusted proxy is the proxy's own address.
+func (app *Application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !app.trustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		if !app.trustedProxy(addr) {
+			return addr
+		}
+
+		host = addr
+	}
+
+	return host
+}
+
+func (app *Application) trustedProxy(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+
+	ip = ip.Unmap()
+
+	for _, prefix := range app.TrustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// userAgent returns the request user agent, truncated so a client can't
+// store arbitrarily large values alongside its session.
+func (app *Application) userAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	return userAgent
+}
+
+// checkVersion makes sure an update was based on the current version of a
+// record, taken from the version in the body or else an If-Match header. A
+// missing or stale version gets a conflict response, so clients can't
+// overwrite changes they never saw.
+func (app *Application) checkVersion(w http.ResponseWriter, r *http.Request, bodyVersion *int, current int) bool {
+	version := bodyVersion
+
+	if version == nil {
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			ifMatch = strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+
+			i, err := strconv.Atoi(ifMatch)
+			if err == nil {
+				version = &i
+			}
+		}
+	}
+
+	if version == nil {
+		app.versionRequiredResponse(w, r)
+		return false
+	}
+
+	if *version != current {
+		app.editConflictResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
 func (app *Application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	s := qs.Get(key)
 	if s == "" {
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/kharljhon14/starbloom-server/internal/jsonlog"
+)
+
+func TestCheckVersion(t *testing.T) {
+	app := &Application{Logger: jsonlog.New(io.Discard, jsonlog.LevelInfo)}
+
+	current, stale := 3, 2
+
+	tests := []struct {
+		name        string
+		bodyVersion *int
+		ifMatch     string
+		wantOK      bool
+	}{
+		{"body version", &current, "", true},
+		{"If-Match", nil, `"3"`, true},
+		{"weak If-Match", nil, `W/"3"`, true},
+		{"missing", nil, "", false},
+		{"unparsable If-Match", nil, "*", false},
+		{"stale body version", &stale, `"3"`, false},
+		{"stale If-Match", nil, `"2"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/api/v1/users/me", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			w := httptest.NewRecorder()
+
+			ok := app.checkVersion(w, r, tt.bodyVersion, current)
+			if ok != tt.wantOK {
+				t.Fatalf("got %t, want %t", ok, tt.wantOK)
+			}
+
+			if !ok && w.Code != http.StatusConflict {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	app := &Application{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor []string
+		want          string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed header", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:5000", []string{"198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"split headers", "10.0.0.2:5000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"only proxies", "10.0.0.2:5000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"no header", "10.0.0.2:5000", nil, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			for _, value := range tt.xForwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := app.clientIP(r); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
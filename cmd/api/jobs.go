@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/jobs"
+)
+
+// purgeBatchSize bounds how many rows a single purge statement deletes.
+const purgeBatchSize = 5000
+
+// Jobs returns the periodic background tasks the server depends on.
+func (app *Application) Jobs() []jobs.Task {
+	tasks := []jobs.Task{
+		{
+			Name:     "flush-sessions",
+			Interval: time.Minute,
+			Jitter:   5 * time.Second,
+			Quiet:    true,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return nil, app.Models.Sessions.Flush()
+			},
+		},
+		{
+			Name:     "purge-expired-tokens",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return purgeInBatches(ctx, app.Models.Tokens.DeleteExpired)
+			},
+		},
+		{
+			Name:     "purge-deleted-accounts",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				before := time.Now().Add(-app.Config.DeletionGracePeriod)
+
+				return purgeInBatches(ctx, func(limit int) (int64, error) {
+					return app.Models.Users.PurgeDeleted(before, limit)
+				})
+			},
+		},
+		{
+			Name:     "purge-expired-username-holds",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return purgeInBatches(ctx, app.Models.Users.DeleteExpiredUsernameHolds)
+			},
+		},
+		{
+			Name:     "purge-expired-mutes",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return purgeInBatches(ctx, app.Models.Mutes.DeleteExpired)
+			},
+		},
+		{
+			Name:     "purge-expired-revocations",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return deletedRows(app.Models.Revocations.DeleteExpired())
+			},
+		},
+		{
+			Name:     "purge-expired-oidc-states",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return deletedRows(app.Models.Identities.DeleteExpiredStates())
+			},
+		},
+		{
+			Name:     "purge-stale-login-throttles",
+			Interval: time.Hour,
+			Jitter:   10 * time.Minute,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				window := max(usernameLockout.Window, ipLockout.Window)
+				return deletedRows(app.Models.Throttles.DeleteStale(time.Now().Add(-window)))
+			},
+		},
+	}
+
+	if app.Signer != nil {
+		tasks = append(tasks, jobs.Task{
+			Name:     "refresh-revocations",
+			Interval: 15 * time.Second,
+			Jitter:   3 * time.Second,
+			Quiet:    true,
+			Run: func(ctx context.Context) (map[string]string, error) {
+				return nil, app.Models.Revocations.Refresh()
+			},
+		})
+	}
+
+	return tasks
+}
+
+// purgeInBatches repeats deleteBatch until a batch comes back short or the
+// runner is stopping.
+func purgeInBatches(ctx context.Context, deleteBatch func(limit int) (int64, error)) (map[string]string, error) {
+	var total int64
+
+	for ctx.Err() == nil {
+		n, err := deleteBatch(purgeBatchSize)
+		total += n
+		if err != nil {
+			return deletedRows(total, err)
+		}
+
+		if n < purgeBatchSize {
+			break
+		}
+	}
+
+	return deletedRows(total, nil)
+}
+
+func deletedRows(n int64, err error) (map[string]string, error) {
+	return map[string]string{"deleted": strconv.FormatInt(n, 10)}, err
+}
@@ -30,6 +30,10 @@ func (app *Application) likePostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if _, ok := app.getVisiblePost(w, r, input.PostID); !ok {
+		return
+	}
+
 	like := data.Like{
 		PostID: input.PostID,
 		UserID: user.ID,
@@ -107,9 +111,7 @@ func (app *Application) getLikeCountHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	_, err := app.Models.Posts.Get(input.PostID)
-	if err != nil {
-		app.notFoundErrorResponse(w, r)
+	if _, ok := app.getVisiblePost(w, r, input.PostID); !ok {
 		return
 	}
 
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+var (
+	usernameLockout = data.LockoutPolicy{
+		Threshold: 5,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+
+	ipLockout = data.LockoutPolicy{
+		Threshold: 20,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}
+)
+
+func usernameThrottleKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// recordLoginFailure counts a failed login against both the username and the
+// client IP, logging the attempt and any lockout it causes.
+func (app *Application) recordLoginFailure(r *http.Request, username string) {
+	ip := app.clientIP(r)
+
+	throttles := []struct {
+		key    string
+		policy data.LockoutPolicy
+	}{
+		{usernameThrottleKey(username), usernameLockout},
+		{ipThrottleKey(ip), ipLockout},
+	}
+
+	for _, throttle := range throttles {
+		failures, lockedFor, err := app.Models.Throttles.RecordFailure(throttle.key, throttle.policy)
+		if err != nil {
+			app.logError(r, err)
+			continue
+		}
+
+		app.Logger.PrintInfo("failed login attempt", map[string]string{
+			"key":      throttle.key,
+			"username": username,
+			"ip":       ip,
+			"failures": strconv.Itoa(failures),
+		})
+
+		if lockedFor > 0 {
+			app.Logger.PrintInfo("login locked", map[string]string{
+				"key":        throttle.key,
+				"username":   username,
+				"ip":         ip,
+				"locked_for": lockedFor.String(),
+			})
+		}
+	}
+}
+
+// reauthenticate checks the password of a signed in user before a sensitive
+// account change, writing the error response itself when it fails. Failures
+// count towards the login lockouts so a stolen token can't be used to guess
+// the password.
+func (app *Application) reauthenticate(w http.ResponseWriter, r *http.Request, user *data.User, password string) bool {
+	lockedFor, err := app.Models.Throttles.LockedFor(
+		usernameThrottleKey(user.Username),
+		ipThrottleKey(app.clientIP(r)),
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if lockedFor > 0 {
+		app.loginLockedResponse(w, r, lockedFor)
+		return false
+	}
+
+	match, _, err := user.Password.Matches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !match {
+		app.recordLoginFailure(r, user.Username)
+
+		v := validator.New()
+		v.AddError("password", "incorrect password")
+		app.validationErrorResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+func (app *Application) unlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Username != "" || input.IP != "", "username", "username or ip is required")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	keys := []string{}
+	if input.Username != "" {
+		keys = append(keys, usernameThrottleKey(input.Username))
+	}
+	if input.IP != "" {
+		keys = append(keys, ipThrottleKey(input.IP))
+	}
+
+	err = app.Models.Throttles.Reset(keys...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.Logger.PrintInfo("login unlocked", map[string]string{
+		"username": input.Username,
+		"ip":       input.IP,
+		"admin_id": strconv.FormatInt(app.getContextUser(r).ID, 10),
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "login attempts unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -51,13 +51,71 @@ func (app *Application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+func (app *Application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.getContextUser(r)
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requireScope rejects requests whose token doesn't hold permission. It is
+// wrapped by requireAuthenticatedUser or requireActivatedUser, which make
+// sure the request carries a token in the first place.
+func (app *Application) requireScope(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.getContextPermissions(r).Include(permission) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin reloads the user rather than trusting the request context, as
+// signed tokens don't carry the admin flag.
+func (app *Application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !user.IsAdmin {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
 func (app *Application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		url := r.URL.String()
 
 		if url == "/api/v1/login" ||
+			url == "/api/v1/login/2fa" ||
+			url == "/api/v1/tokens/refresh" ||
 			url == "/api/v1/signup" ||
-			url == "/api/v1/health" {
+			url == "/api/v1/users/activate" ||
+			url == "/api/v1/users/email/confirm" ||
+			url == "/api/v1/password-reset" ||
+			url == "/api/v1/password" ||
+			url == "/api/v1/health" ||
+			strings.HasPrefix(r.URL.Path, "/api/v1/auth/oidc/") {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -80,14 +138,41 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		var (
+			user        *data.User
+			permissions data.Permissions
+			err         error
+		)
+
 		v := validator.New()
 
-		if data.ValidateTokenPlainText(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
-			return
+		switch {
+		case data.IsSignedToken(token):
+			var ok bool
+
+			user, ok = app.verifySignedToken(token)
+			if !ok {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			permissions = data.SessionPermissions
+		case data.IsPersonalAccessToken(token):
+			if data.ValidatePersonalAccessToken(v, token); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			user, permissions, err = app.lookupToken(data.ScopeAuthorization, token)
+		default:
+			if data.ValidateTokenPlainText(v, token); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			user, permissions, err = app.lookupToken(data.ScopeAuthentication, token)
 		}
 
-		user, err := app.Models.Tokens.GetForToken(data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrNoRecordFound):
@@ -98,12 +183,82 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		app.Models.Sessions.Touch(token)
+
 		r = app.setContextUser(r, user)
+		r = app.setContextToken(r, token)
+		r = app.setContextPermissions(r, permissions)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// lookupToken resolves an opaque token to its user and permissions, going
+// through the authentication cache before the database.
+func (app *Application) lookupToken(scope, token string) (*data.User, data.Permissions, error) {
+	cache := app.Models.Tokens.Cache
+
+	if user, permissions, ok := cache.Get(token); ok {
+		return user, permissions, nil
+	}
+
+	// Read the generation before the database so a token deleted while we
+	// look it up isn't put back in the cache
+	generation := cache.Generation()
+
+	user, t, err := app.Models.Tokens.GetWithUser(scope, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions := data.SessionPermissions
+	if scope == data.ScopeAuthorization {
+		permissions = t.Permissions
+	}
+
+	cache.Set(generation, token, user, permissions, t.ExpiredAt)
+
+	return user, permissions, nil
+}
+
+// verifySignedToken validates a signed authentication token using only its
+// signature, expiry and the in-memory revocation list.
+func (app *Application) verifySignedToken(token string) (*data.User, bool) {
+	if app.Signer == nil || len(token) > 1024 {
+		return nil, false
+	}
+
+	claims, err := app.Signer.Verify(token)
+	if err != nil || claims.Scope != data.ScopeAuthentication {
+		return nil, false
+	}
+
+	if app.Models.Revocations.IsRevoked(token) {
+		return nil, false
+	}
+
+	user := &data.User{
+		ID:        claims.UserID,
+		Activated: claims.Activated,
+	}
+
+	return user, true
+}
+
+// reloadRevocations refreshes the revocation list after tokens have been
+// deleted so revoked signed tokens stop working on this instance right away.
+// Other instances pick the change up on their next periodic refresh.
+func (app *Application) reloadRevocations() {
+	if app.Signer == nil {
+		return
+	}
+
+	err := app.Models.Revocations.Refresh()
+	if err != nil {
+		app.Logger.PrintError(err.Error(), nil)
+	}
+}
+
 func (app *Application) enableCors(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -118,10 +273,12 @@ func (app *Application) enableCors(next http.Handler) http.HandlerFunc {
 
 		if slices.Contains(strings.Fields(trustedOrigins), origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
+			// Lets trusted front ends keep the OIDC state cookie
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
-				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH, DELETE")
-				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
 
 				w.WriteHeader(http.StatusOK)
 				return
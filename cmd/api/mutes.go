@@ -0,0 +1,195 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+// maxMuteHours bounds expires_in_hours. Mutes without an expiry last until
+// they are removed.
+const maxMuteHours = 365 * 24
+
+// muteExpiry converts expires_in_hours into an expiry time, nil meaning the
+// mute never expires.
+func muteExpiry(v *validator.Validator, hours int) *time.Time {
+	v.Check(hours >= 0, "expires_in_hours", "expires_in_hours must not be negative")
+	v.Check(hours <= maxMuteHours, "expires_in_hours", "expires_in_hours must not exceed 8760")
+
+	if hours <= 0 {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(time.Duration(hours) * time.Hour)
+	return &expiresAt
+}
+
+func (app *Application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	var input struct {
+		UserID         int64 `json:"user_id"`
+		ExpiresInHours int   `json:"expires_in_hours"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID != 0, "user_id", "user_id is required")
+	v.Check(input.UserID != user.ID, "user_id", "must not be own user_id")
+	expiresAt := muteExpiry(v, input.ExpiresInHours)
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	muted, err := app.Models.Mutes.MuteUser(user.ID, input.UserID, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"muted_user": muted}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil || userID < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	err = app.Models.Mutes.UnmuteUser(app.getContextUser(r).ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user unmuted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) listMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var filter data.Filter
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter.Page = app.readInt(qs, "page", 1, v)
+	filter.PageSize = app.readInt(qs, "pageSize", 50, v)
+
+	if data.ValidateFilters(v, filter); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.Models.Mutes.GetMutedUsers(app.getContextUser(r).ID, filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"_metadata": metadata, "muted_users": users}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) muteKeywordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Keyword        string `json:"keyword"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	input.Keyword = data.NormalizeKeyword(input.Keyword)
+
+	v := validator.New()
+
+	data.ValidateKeyword(v, input.Keyword)
+	expiresAt := muteExpiry(v, input.ExpiresInHours)
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	keyword, err := app.Models.Mutes.MuteKeyword(app.getContextUser(r).ID, input.Keyword, expiresAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"muted_keyword": keyword}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) unmuteKeywordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	err = app.Models.Mutes.UnmuteKeyword(app.getContextUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "keyword unmuted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) listMutedKeywordsHandler(w http.ResponseWriter, r *http.Request) {
+	keywords, err := app.Models.Mutes.GetMutedKeywords(app.getContextUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"muted_keywords": keywords}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/oidc"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+var (
+	errOIDCEmailRequired   = errors.New("the identity provider did not share an email address")
+	errOIDCEmailUnverified = errors.New("the identity provider has not verified this email address")
+)
+
+const (
+	// oidcStateCookie binds a login state to the user agent that started
+	// the flow, so a callback can't be completed in someone else's browser
+	oidcStateCookie = "starbloom_oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+func (app *Application) startOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	authURL, ok := app.beginOIDCFlow(w, r, nil)
+	if !ok {
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// startOIDCLinkHandler begins the flow for linking a provider account to the
+// signed in user. The client sends the user agent to the returned URL, and
+// must make this request with credentials included so the state cookie is
+// kept.
+func (app *Application) startOIDCLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID := app.getContextUser(r).ID
+
+	authURL, ok := app.beginOIDCFlow(w, r, &userID)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"authorization_url": authURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// beginOIDCFlow saves the login state for the provider named in the path and
+// returns the provider URL to send the user agent to. linkUserID is set when
+// the flow links the provider account to an existing user.
+func (app *Application) beginOIDCFlow(w http.ResponseWriter, r *http.Request, linkUserID *int64) (string, bool) {
+	name := r.PathValue("provider")
+
+	provider, ok := app.OIDCProviders[name]
+	if !ok {
+		app.notFoundErrorResponse(w, r)
+		return "", false
+	}
+
+	var values [3]string
+
+	for i := range values {
+		value, err := oidc.RandomString(32)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return "", false
+		}
+
+		values[i] = value
+	}
+
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	err := app.Models.Identities.SaveState(state, &data.OIDCState{
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+		ExpiredAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return "", false
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return "", false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/oidc/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		// Lax still sends the cookie on the top level redirect back from
+		// the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return authURL, true
+}
+
+func (app *Application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+
+	provider, ok := app.OIDCProviders[name]
+	if !ok {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	if providerError := qs.Get("error"); providerError != "" {
+		app.badRequestErrorResponse(w, r, fmt.Errorf("identity provider returned an error: %s", providerError))
+		return
+	}
+
+	code := qs.Get("code")
+	state := qs.Get("state")
+
+	v := validator.New()
+
+	v.Check(code != "", "code", "code is required")
+	v.Check(state != "", "state", "state is required")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		app.badRequestErrorResponse(w, r, errors.New("login state was not started by this browser"))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/v1/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	oidcState, err := app.Models.Identities.ConsumeState(state)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.badRequestErrorResponse(w, r, errors.New("invalid or expired login state"))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if oidcState.Provider != name {
+		app.badRequestErrorResponse(w, r, errors.New("invalid or expired login state"))
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, oidcState.CodeVerifier, oidcState.Nonce)
+	if err != nil {
+		app.logError(r, err)
+		app.invalidCredentialsErrorResponse(w, r)
+		return
+	}
+
+	if oidcState.LinkUserID != nil {
+		app.linkIdentity(w, r, name, *oidcState.LinkUserID, claims)
+		return
+	}
+
+	user, err := app.userForIdentity(name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists, log in with your password and link this provider from your account")
+			app.validationErrorResponse(w, r, v.Errors)
+		case errors.Is(err, errOIDCEmailRequired), errors.Is(err, errOIDCEmailUnverified):
+			app.badRequestErrorResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// linkIdentity finishes a flow started by startOIDCLinkHandler, linking the
+// provider account to the user who started it.
+func (app *Application) linkIdentity(w http.ResponseWriter, r *http.Request, provider string, userID int64, claims *oidc.Claims) {
+	identity := &data.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		UserID:   userID,
+		Email:    claims.Email,
+	}
+
+	err := app.Models.Identities.Insert(identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrIdentityLinked):
+			v := validator.New()
+			v.AddError("provider", "this provider account is already linked to a user")
+			app.validationErrorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"identity": identity}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// userForIdentity returns the user linked to the provider account, creating
+// a new user on first login. Provider accounts are never linked to existing
+// users by email here, since whoever controls the provider account would
+// take over the local one. Users link providers themselves while signed in,
+// and a first login whose email is already taken fails with
+// ErrDuplicateEmail. New users are only created for emails the provider has
+// verified, so nobody can hold an address they don't own.
+func (app *Application) userForIdentity(provider string, claims *oidc.Claims) (*data.User, error) {
+	user, err := app.Models.Identities.GetUser(provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+
+	if !errors.Is(err, data.ErrNoRecordFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errOIDCEmailRequired
+	}
+
+	if !claims.EmailVerified {
+		return nil, errOIDCEmailUnverified
+	}
+
+	user, err = app.createUserFromClaims(provider, claims)
+	if errors.Is(err, data.ErrIdentityLinked) || errors.Is(err, data.ErrDuplicateEmail) {
+		// Another callback for the same provider account may have just
+		// created the user
+		linked, lookupErr := app.Models.Identities.GetUser(provider, claims.Subject)
+		if lookupErr == nil {
+			return linked, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// createUserFromClaims creates an activated user linked to the provider
+// account. The caller must have checked that the email is verified.
+func (app *Application) createUserFromClaims(provider string, claims *oidc.Claims) (*data.User, error) {
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" || lastName == "" {
+		first, last, _ := strings.Cut(strings.TrimSpace(claims.Name), " ")
+		firstName = cmp.Or(firstName, first)
+		lastName = cmp.Or(lastName, last)
+	}
+
+	user := &data.User{
+		Email:     claims.Email,
+		FirstName: cmp.Or(firstName, "Starbloom"),
+		LastName:  cmp.Or(lastName, "User"),
+		Activated: true,
+	}
+
+	identity := &data.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	// Users created through a provider sign in there, so their password is
+	// random and never shared with them
+	password, err := oidc.RandomString(24)
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	base := usernameBase(claims)
+
+	for attempt := 0; attempt < 5; attempt++ {
+		user.Username = base
+
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10_000))
+			if err != nil {
+				return nil, err
+			}
+
+			user.Username = fmt.Sprintf("%s_%04d", base, suffix.Int64())
+		}
+
+		v := validator.New()
+
+		if data.ValidateUser(v, user); !v.Valid() {
+			return nil, fmt.Errorf("invalid user from identity provider: %v", v.Errors)
+		}
+
+		err = app.Models.Identities.InsertWithUser(user, identity)
+		if errors.Is(err, data.ErrDuplicateUsername) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+
+	return nil, errors.New("could not generate a unique username")
+}
+
+// usernameBase derives a username from the preferred username or the local
+// part of the email, keeping only characters that are safe in a handle.
+func usernameBase(claims *oidc.Claims) string {
+	source := claims.PreferredUsername
+	if source == "" {
+		source, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(source) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' {
+			b.WriteRune(r)
+		}
+
+		if b.Len() == 40 {
+			break
+		}
+	}
+
+	base := b.String()
+	if len(base) < 5 {
+		base = "user_" + base
+	}
+
+	return base
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kharljhon14/starbloom-server/internal/jsonlog"
+	"github.com/kharljhon14/starbloom-server/internal/oidc"
+)
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	app := &Application{
+		Logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		OIDCProviders: map[string]*oidc.Provider{
+			"test": oidc.NewProvider(oidc.ProviderConfig{Name: "test", Issuer: "https://issuer.test"}),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no cookie", nil},
+		{"cookie for another state", &http.Cookie{Name: oidcStateCookie, Value: "someone-elses-state"}},
+		{"empty cookie", &http.Cookie{Name: oidcStateCookie, Value: ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/test/callback?code=abc&state=victim-state", nil)
+			r.SetPathValue("provider", "test")
+
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+
+			w := httptest.NewRecorder()
+
+			app.oidcCallbackHandler(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -58,14 +58,8 @@ func (app *Application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := app.Models.Posts.Get(ID)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrNoRecordFound):
-			app.notFoundErrorResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+	post, ok := app.getVisiblePost(w, r, ID)
+	if !ok {
 		return
 	}
 
@@ -99,6 +93,10 @@ func (app *Application) getPostsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !app.requireVisibleUser(w, r, input.ID) {
+		return
+	}
+
 	posts, metadata, err := app.Models.Posts.GetAll(input.ID, input.Filter)
 	if err != nil {
 
@@ -230,7 +228,9 @@ func (app *Application) getFollowingPostsHandler(w http.ResponseWriter, r *http.
 
 	qs := r.URL.Query()
 
-	ID := app.readInt(qs, "id", 0, v)
+	user := app.getContextUser(r)
+
+	ID := app.readInt(qs, "id", int(user.ID), v)
 	page := app.readInt(qs, "page", 1, v)
 	pageSize := app.readInt(qs, "pageSize", 50, v)
 
@@ -244,6 +244,13 @@ func (app *Application) getFollowingPostsHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// The feed includes posts from private accounts the user follows, so
+	// only its owner may read it
+	if input.ID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	posts, metadata, err := app.Models.Follows.GetFollowingPosts(input.ID, input.Filter)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+)
+
+// requireVisibleUser checks the request's user may see content owned by
+// ownerID, writing the error response itself when they can't.
+func (app *Application) requireVisibleUser(w http.ResponseWriter, r *http.Request, ownerID int64) bool {
+	visible, err := app.Models.Users.CanView(ownerID, app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	if !visible {
+		app.privateAccountResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// getVisiblePost loads a post the request's user may see. Posts they can't
+// see are reported as not found so their existence isn't revealed.
+func (app *Application) getVisiblePost(w http.ResponseWriter, r *http.Request, postID int64) (*data.Post, bool) {
+	post, err := app.Models.Posts.Get(postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	visible, err := app.Models.Users.CanView(post.UserID, app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !visible {
+		app.notFoundErrorResponse(w, r)
+		return nil, false
+	}
+
+	return post, true
+}
@@ -1,12 +1,22 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/kharljhon14/starbloom-server/internal/data"
 	"github.com/kharljhon14/starbloom-server/internal/jsonlog"
+	"github.com/kharljhon14/starbloom-server/internal/mailer"
+	"github.com/kharljhon14/starbloom-server/internal/oidc"
 )
 
 const version = "1.0.0"
@@ -17,12 +27,71 @@ type Config struct {
 	Db   struct {
 		Dsn string
 	}
+	Smtp struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		Sender   string
+	}
+	// MailFile is where emails are written when no SMTP host is configured.
+	// An empty value writes them to stdout.
+	MailFile string
+	Tokens   struct {
+		// Format of newly issued authentication tokens, opaque or signed.
+		// Signed tokens are accepted whenever signing keys are configured.
+		Format       string
+		SigningKeys  string
+		SigningKeyID string
+	}
+	Passwords struct {
+		// Hasher used for new password hashes, argon2id or bcrypt. Hashes
+		// made by the other one are upgraded when their owner logs in.
+		Hasher            string
+		Argon2Memory      uint
+		Argon2Iterations  uint
+		Argon2Parallelism uint
+		BcryptCost        int
+	}
+	// AuthCache bounds the in-memory cache of authenticated tokens. A zero
+	// TTL or size disables it. Revoked tokens stay cached on other instances
+	// for up to the TTL.
+	AuthCache struct {
+		TTL  time.Duration
+		Size int
+	}
+	// DeletionGracePeriod is how long an account pending deletion can still be
+	// restored by logging in before it is purged.
+	DeletionGracePeriod time.Duration
+	// Usernames controls how often users can rename and what happens to the
+	// usernames they give up.
+	Usernames struct {
+		// ChangeCooldown is how long users must wait between renames.
+		ChangeCooldown time.Duration
+		// HoldPeriod is how long a retired username keeps resolving to its
+		// previous owner before anyone else can claim it.
+		HoldPeriod time.Duration
+	}
+	// OIDCConfigFile is a JSON file listing the OpenID Connect providers users
+	// can sign in with.
+	OIDCConfigFile string
+	// TrustedProxies is a comma separated list of addresses or CIDR ranges of
+	// the reverse proxies in front of the server.
+	TrustedProxies string
 }
 
 type Application struct {
 	Config Config
 	Logger *jsonlog.Logger
 	Models data.Models
+	Mailer mailer.Mailer
+	Signer *data.TokenSigner
+	// OIDCProviders are keyed by the provider name used in the login URLs.
+	OIDCProviders map[string]*oidc.Provider
+	// TrustedProxies are the networks whose X-Forwarded-For headers are
+	// believed when working out the client IP.
+	TrustedProxies []netip.Prefix
+	wg             sync.WaitGroup
 }
 
 func (app *Application) Mount() http.Handler {
@@ -32,31 +101,81 @@ func (app *Application) Mount() http.Handler {
 
 	mux.HandleFunc("POST /api/v1/signup", app.createUserHandler)
 	mux.HandleFunc("POST /api/v1/login", app.createAuthenticationTokenHandler)
-	mux.HandleFunc("GET /api/v1/validate-token", app.requireAuthenticatedUser(app.getAuthenticatedUserHandler))
-	mux.HandleFunc("GET /api/v1/users/{username}", app.requireAuthenticatedUser(app.getUserhandler))
-
-	mux.HandleFunc("POST /api/v1/follow", app.requireAuthenticatedUser(app.followUserHandler))
-	mux.HandleFunc("POST /api/v1/unfollow", app.requireAuthenticatedUser(app.unFollowUserHandler))
-
-	mux.HandleFunc("GET /api/v1/followers", app.requireAuthenticatedUser(app.getFollowersHandler))
-
-	mux.HandleFunc("GET /api/v1/posts", app.requireAuthenticatedUser(app.getPostsHandler))
-	mux.HandleFunc("POST /api/v1/posts", app.requireAuthenticatedUser(app.createPostHandler))
-	mux.HandleFunc("GET /api/v1/posts/{id}", app.requireAuthenticatedUser(app.getPostHandler))
-	mux.HandleFunc("PATCH /api/v1/posts/{id}", app.requireAuthenticatedUser(app.updatePostHandler))
-	mux.HandleFunc("DELETE /api/v1/posts/{id}", app.requireAuthenticatedUser(app.deletePostHandler))
-
-	mux.HandleFunc("GET /api/v1/posts/following", app.requireAuthenticatedUser(app.getFollowingPostsHandler))
-
-	mux.HandleFunc("GET /api/v1/like", app.requireAuthenticatedUser(app.getLikeCountHandler))
-	mux.HandleFunc("POST /api/v1/like", app.requireAuthenticatedUser(app.likePostHandler))
-	mux.HandleFunc("POST /api/v1/unlike", app.requireAuthenticatedUser(app.unlikePostHandler))
-
-	mux.HandleFunc("POST /api/v1/comments", app.requireAuthenticatedUser(app.addCommentHandler))
-	mux.HandleFunc("GET /api/v1/comments/{id}", app.requireAuthenticatedUser(app.getCommentByIDHandler))
-	mux.HandleFunc("GET /api/v1/comments", app.requireAuthenticatedUser(app.getCommentsByPostHandler))
-	mux.HandleFunc("PATCH /api/v1/comments/{id}", app.requireAuthenticatedUser(app.updateCommentHandler))
-	mux.HandleFunc("DELETE /api/v1/comments/{id}", app.requireAuthenticatedUser(app.deleteCommentHandler))
+	mux.HandleFunc("GET /api/v1/auth/oidc/{provider}/start", app.startOIDCLoginHandler)
+	mux.HandleFunc("GET /api/v1/auth/oidc/{provider}/callback", app.oidcCallbackHandler)
+	mux.HandleFunc("POST /api/v1/users/me/identities/{provider}", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.startOIDCLinkHandler)))
+	mux.HandleFunc("POST /api/v1/login/2fa", app.completeTwoFactorLoginHandler)
+	mux.HandleFunc("POST /api/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	mux.HandleFunc("POST /api/v1/logout", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.logoutHandler)))
+	mux.HandleFunc("POST /api/v1/logout/all", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.logoutAllHandler)))
+	mux.HandleFunc("PUT /api/v1/users/activate", app.activateUserHandler)
+	mux.HandleFunc("POST /api/v1/password-reset", app.createPasswordResetTokenHandler)
+	mux.HandleFunc("PUT /api/v1/password", app.updateUserPasswordHandler)
+	mux.HandleFunc("GET /api/v1/validate-token", app.requireAuthenticatedUser(app.requireScope(data.PermissionUsersRead, app.getAuthenticatedUserHandler)))
+	mux.HandleFunc("GET /api/v1/users", app.requireAuthenticatedUser(app.requireScope(data.PermissionUsersRead, app.searchUsersHandler)))
+	mux.HandleFunc("GET /api/v1/users/suggestions", app.requireAuthenticatedUser(app.requireScope(data.PermissionUsersRead, app.getSuggestionsHandler)))
+	mux.HandleFunc("GET /api/v1/users/{username}", app.requireAuthenticatedUser(app.requireScope(data.PermissionUsersRead, app.getUserhandler)))
+
+	mux.HandleFunc("PATCH /api/v1/users/me", app.requireAuthenticatedUser(app.requireScope(data.PermissionUsersWrite, app.updateProfileHandler)))
+	mux.HandleFunc("DELETE /api/v1/users/me", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.deleteUserHandler)))
+	mux.HandleFunc("PUT /api/v1/users/me/username", app.requireActivatedUser(app.requireScope(data.PermissionUsersWrite, app.changeUsernameHandler)))
+	mux.HandleFunc("POST /api/v1/users/me/email", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.requestEmailChangeHandler)))
+	mux.HandleFunc("PUT /api/v1/users/email/confirm", app.confirmEmailChangeHandler)
+
+	mux.HandleFunc("POST /api/v1/users/me/2fa", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.beginTwoFactorEnrollmentHandler)))
+	mux.HandleFunc("POST /api/v1/users/me/2fa/confirm", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.confirmTwoFactorEnrollmentHandler)))
+	mux.HandleFunc("DELETE /api/v1/users/me/2fa", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.disableTwoFactorHandler)))
+
+	mux.HandleFunc("POST /api/v1/admin/unlock", app.requireAdmin(app.requireScope(data.PermissionAccount, app.unlockLoginHandler)))
+	mux.HandleFunc("GET /api/v1/admin/metrics", app.requireAdmin(app.requireScope(data.PermissionAccount, expvar.Handler().ServeHTTP)))
+
+	mux.HandleFunc("GET /api/v1/tokens", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.listPersonalAccessTokensHandler)))
+	mux.HandleFunc("POST /api/v1/tokens", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.createPersonalAccessTokenHandler)))
+	mux.HandleFunc("DELETE /api/v1/tokens/{id}", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.deletePersonalAccessTokenHandler)))
+
+	mux.HandleFunc("GET /api/v1/sessions", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.listSessionsHandler)))
+	mux.HandleFunc("DELETE /api/v1/sessions", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.deleteOtherSessionsHandler)))
+	mux.HandleFunc("DELETE /api/v1/sessions/{id}", app.requireAuthenticatedUser(app.requireScope(data.PermissionAccount, app.deleteSessionHandler)))
+
+	mux.HandleFunc("POST /api/v1/follow", app.requireActivatedUser(app.requireScope(data.PermissionFollowsWrite, app.followUserHandler)))
+	mux.HandleFunc("POST /api/v1/unfollow", app.requireActivatedUser(app.requireScope(data.PermissionFollowsWrite, app.unFollowUserHandler)))
+
+	mux.HandleFunc("GET /api/v1/follow-requests", app.requireAuthenticatedUser(app.requireScope(data.PermissionFollowsRead, app.listFollowRequestsHandler)))
+	mux.HandleFunc("POST /api/v1/follow-requests/{requesterID}/approve", app.requireActivatedUser(app.requireScope(data.PermissionFollowsWrite, app.approveFollowRequestHandler)))
+	mux.HandleFunc("DELETE /api/v1/follow-requests/{requesterID}", app.requireActivatedUser(app.requireScope(data.PermissionFollowsWrite, app.rejectFollowRequestHandler)))
+
+	mux.HandleFunc("GET /api/v1/blocks", app.requireAuthenticatedUser(app.requireScope(data.PermissionBlocksRead, app.listBlocksHandler)))
+	mux.HandleFunc("POST /api/v1/blocks", app.requireAuthenticatedUser(app.requireScope(data.PermissionBlocksWrite, app.blockUserHandler)))
+	mux.HandleFunc("DELETE /api/v1/blocks/{userID}", app.requireAuthenticatedUser(app.requireScope(data.PermissionBlocksWrite, app.unblockUserHandler)))
+
+	mux.HandleFunc("GET /api/v1/mutes/users", app.requireAuthenticatedUser(app.requireScope(data.PermissionMutesRead, app.listMutedUsersHandler)))
+	mux.HandleFunc("POST /api/v1/mutes/users", app.requireAuthenticatedUser(app.requireScope(data.PermissionMutesWrite, app.muteUserHandler)))
+	mux.HandleFunc("DELETE /api/v1/mutes/users/{userID}", app.requireAuthenticatedUser(app.requireScope(data.PermissionMutesWrite, app.unmuteUserHandler)))
+	mux.HandleFunc("GET /api/v1/mutes/keywords", app.requireAuthenticatedUser(app.requireScope(data.PermissionMutesRead, app.listMutedKeywordsHandler)))
+	mux.HandleFunc("POST /api/v1/mutes/keywords", app.requireAuthenticatedUser(app.requireScope(data.PermissionMutesWrite, app.muteKeywordHandler)))
+	mux.HandleFunc("DELETE /api/v1/mutes/keywords/{id}", app.requireAuthenticatedUser(app.requireScope(data.PermissionMutesWrite, app.unmuteKeywordHandler)))
+
+	mux.HandleFunc("GET /api/v1/followers", app.requireAuthenticatedUser(app.requireScope(data.PermissionFollowsRead, app.getFollowersHandler)))
+	mux.HandleFunc("GET /api/v1/following", app.requireAuthenticatedUser(app.requireScope(data.PermissionFollowsRead, app.getFollowingHandler)))
+	mux.HandleFunc("GET /api/v1/mutuals", app.requireAuthenticatedUser(app.requireScope(data.PermissionFollowsRead, app.getMutualsHandler)))
+
+	mux.HandleFunc("GET /api/v1/posts", app.requireAuthenticatedUser(app.requireScope(data.PermissionPostsRead, app.getPostsHandler)))
+	mux.HandleFunc("POST /api/v1/posts", app.requireActivatedUser(app.requireScope(data.PermissionPostsWrite, app.createPostHandler)))
+	mux.HandleFunc("GET /api/v1/posts/{id}", app.requireAuthenticatedUser(app.requireScope(data.PermissionPostsRead, app.getPostHandler)))
+	mux.HandleFunc("PATCH /api/v1/posts/{id}", app.requireActivatedUser(app.requireScope(data.PermissionPostsWrite, app.updatePostHandler)))
+	mux.HandleFunc("DELETE /api/v1/posts/{id}", app.requireActivatedUser(app.requireScope(data.PermissionPostsWrite, app.deletePostHandler)))
+
+	mux.HandleFunc("GET /api/v1/posts/following", app.requireAuthenticatedUser(app.requireScope(data.PermissionPostsRead, app.getFollowingPostsHandler)))
+
+	mux.HandleFunc("GET /api/v1/like", app.requireAuthenticatedUser(app.requireScope(data.PermissionLikesRead, app.getLikeCountHandler)))
+	mux.HandleFunc("POST /api/v1/like", app.requireActivatedUser(app.requireScope(data.PermissionLikesWrite, app.likePostHandler)))
+	mux.HandleFunc("POST /api/v1/unlike", app.requireActivatedUser(app.requireScope(data.PermissionLikesWrite, app.unlikePostHandler)))
+
+	mux.HandleFunc("POST /api/v1/comments", app.requireActivatedUser(app.requireScope(data.PermissionCommentsWrite, app.addCommentHandler)))
+	mux.HandleFunc("GET /api/v1/comments/{id}", app.requireAuthenticatedUser(app.requireScope(data.PermissionCommentsRead, app.getCommentByIDHandler)))
+	mux.HandleFunc("GET /api/v1/comments", app.requireAuthenticatedUser(app.requireScope(data.PermissionCommentsRead, app.getCommentsByPostHandler)))
+	mux.HandleFunc("PATCH /api/v1/comments/{id}", app.requireActivatedUser(app.requireScope(data.PermissionCommentsWrite, app.updateCommentHandler)))
+	mux.HandleFunc("DELETE /api/v1/comments/{id}", app.requireActivatedUser(app.requireScope(data.PermissionCommentsWrite, app.deleteCommentHandler)))
 
 	return app.recoverPanic(app.logRequest(app.enableCors((app.authenticate(mux)))))
 }
@@ -70,10 +189,56 @@ func (app *Application) Serve(router http.Handler) error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	if app.Signer != nil {
+		err := app.Models.Revocations.Refresh()
+		if err != nil {
+			return err
+		}
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.Logger.PrintInfo("shutting down server", map[string]string{
+			"signal": s.String(),
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		// Wait for emails and other work started by handlers
+		app.wg.Wait()
+		shutdownError <- nil
+	}()
+
 	app.Logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.Config.Env,
 	})
 
-	return srv.ListenAndServe()
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.Logger.PrintInfo("stopped server", map[string]string{
+		"addr": srv.Addr,
+	})
+
+	return nil
 }
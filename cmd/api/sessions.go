@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+)
+
+func (app *Application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	sessions, err := app.Models.Tokens.GetSessions(user.ID, app.getContextToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	ID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || ID < 1 {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	err = app.Models.Tokens.DeleteSession(user.ID, ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.reloadRevocations()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getContextUser(r)
+
+	err := app.Models.Tokens.DeleteOtherSessions(user.ID, app.getContextToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.reloadRevocations()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "signed out of all other sessions"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,13 +1,20 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/kharljhon14/starbloom-server/internal/data"
 	"github.com/kharljhon14/starbloom-server/internal/validator"
 )
 
+const (
+	authenticationTokenTTL = 15 * time.Minute
+	refreshTokenTTL        = 30 * 24 * time.Hour
+)
+
 func (app *Application) createAuthenticationTokenHandler(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -33,45 +40,309 @@ func (app *Application) createAuthenticationTokenHandler(
 		return
 	}
 
+	// Check lockouts before doing any password hashing so locked out
+	// attempts stay cheap
+	usernameKey := usernameThrottleKey(input.Username)
+
+	lockedFor, err := app.Models.Throttles.LockedFor(usernameKey, ipThrottleKey(app.clientIP(r)))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if lockedFor > 0 {
+		app.Logger.PrintInfo("locked login attempt", map[string]string{
+			"username": input.Username,
+			"ip":       app.clientIP(r),
+		})
+		app.loginLockedResponse(w, r, lockedFor)
+		return
+	}
+
 	user, err := app.Models.Users.GetUser(input.Username)
 	if err != nil {
+		app.recordLoginFailure(r, input.Username)
 		app.invalidCredentialsErrorResponse(w, r)
 		return
 	}
 
-	match, err := user.Password.Matches(input.Password)
+	match, outdated, err := user.Password.Matches(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	if !match {
+		app.recordLoginFailure(r, input.Username)
 		app.invalidCredentialsErrorResponse(w, r)
 		return
 	}
 
-	err = app.Models.Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if outdated {
+		app.rehashPassword(user, input.Password)
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// rehashPassword upgrades a hash made with an old algorithm or parameters.
+// Failing to do so doesn't stop the login, the hash is retried next time.
+func (app *Application) rehashPassword(user *data.User, plainTextPassword string) {
+	err := user.Password.Set(plainTextPassword)
+	if err == nil {
+		err = app.Models.Users.Update(user)
+	}
+
 	if err != nil {
+		app.Logger.PrintError(err.Error(), map[string]string{
+			"user_id": strconv.FormatInt(user.ID, 10),
+		})
+	}
+}
+
+// completeLogin finishes a successful first-factor login. Users with
+// two-factor authentication get a short-lived mfa pending token to exchange
+// along with a code, everyone else gets a session straight away. Failed
+// attempts are only forgiven once a session is issued, so a known password
+// doesn't reset the budget for guessing codes.
+func (app *Application) completeLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
+	twoFactor, err := app.Models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.Models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if twoFactor != nil && twoFactor.Enabled {
+		token, err := app.Models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFAPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"mfa_required": true, "mfa_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Throttles.Reset(usernameThrottleKey(user.Username))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"authentication_token": token}, nil)
+	app.issueSessionTokens(w, r, user)
+}
+
+// issueSessionTokens starts a new session for user and writes its
+// authentication and refresh tokens to the response.
+func (app *Application) issueSessionTokens(w http.ResponseWriter, r *http.Request, user *data.User) {
+	// Logging back in is how a pending account deletion is cancelled
+	cancelled, err := app.Models.Users.CancelDeletion(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if cancelled {
+		app.Logger.PrintInfo("account deletion cancelled", map[string]string{
+			"user_id": strconv.FormatInt(user.ID, 10),
+		})
+	}
+
+	access, refresh, err := app.Models.Tokens.NewSession(
+		user,
+		authenticationTokenTTL,
+		refreshTokenTTL,
+		app.userAgent(r),
+		app.clientIP(r),
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"authentication_token": access,
+		"refresh_token":        refresh,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *Application) getAuthenticatedUserHandler(w http.ResponseWriter, r *http.Request) {
+func (app *Application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.RefreshToken); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	access, refresh, err := app.Models.Tokens.RotateRefreshToken(
+		input.RefreshToken,
+		authenticationTokenTTL,
+		refreshTokenTTL,
+		app.userAgent(r),
+		app.clientIP(r),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReuse):
+			app.Logger.PrintInfo("refresh token reuse detected, token family revoked", map[string]string{
+				"ip":         app.clientIP(r),
+				"user_agent": app.userAgent(r),
+			})
+			app.reloadRevocations()
+			app.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"authentication_token": access,
+		"refresh_token":        refresh,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.Models.Tokens.DeleteForToken(data.ScopeAuthentication, app.getContextToken(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.reloadRevocations()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.getContextUser(r)
 
-	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	err := app.Models.Tokens.DeleteAllSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.reloadRevocations()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully logged out of all sessions"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) getAuthenticatedUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Signed tokens only carry the user ID, so load the full record
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	stats, _, err := app.Models.Users.GetStats(user.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Self(), "stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	// Respond the same way whether or not the email exists so the endpoint
+	// can't be used to discover registered addresses
+	env := envelope{"message": "if an account with that email exists, you will receive password reset instructions shortly"}
+
+	user, err := app.Models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.Models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"passwordResetToken": token.PlainText,
+		}
+
+		err := app.Mailer.Send(user.Email, "token_password_reset.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err.Error(), nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/totp"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+const totpIssuer = "Starbloom"
+
+func (app *Application) beginTwoFactorEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.TwoFactor.SetPendingSecret(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			app.badRequestErrorResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Username, secret),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) confirmTwoFactorEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	// Signed tokens only carry the user ID, and the lockouts are keyed on
+	// the username
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Code != "", "code", "code is required")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	twoFactor, err := app.Models.TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.badRequestErrorResponse(w, r, errors.New("two-factor enrollment has not been started"))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if twoFactor.Enabled {
+		app.badRequestErrorResponse(w, r, data.ErrTwoFactorEnabled)
+		return
+	}
+
+	if app.secondFactorLocked(w, r, user) {
+		return
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, input.Code, time.Now(), 1)
+	if !ok {
+		app.recordLoginFailure(r, user.Username)
+
+		v.AddError("code", "invalid code")
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := app.Models.TwoFactor.Enable(user.ID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			app.badRequestErrorResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTwoFactorHandler turns two-factor authentication off. It takes the
+// password as well as a code, so a stolen session alone isn't enough.
+func (app *Application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Password != "", "password", "password is required")
+	validateSecondFactorInput(v, input.Code, input.RecoveryCode)
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password) {
+		return
+	}
+
+	twoFactor, err := app.Models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if twoFactor == nil || !twoFactor.Enabled {
+		app.badRequestErrorResponse(w, r, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+
+	ok, err := app.verifySecondFactor(twoFactor, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.recordLoginFailure(r, user.Username)
+
+		v.AddError("code", "invalid code")
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.TwoFactor.Disable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// completeTwoFactorLoginHandler exchanges the mfa pending token issued by the
+// login handler and a second factor for a real session. The pending token is
+// consumed before the code is checked, so each token is good for one guess
+// even when requests race. A wrong code counts towards the login lockouts
+// and comes back with a fresh token to try again with.
+func (app *Application) completeTwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateTokenPlainText(v, input.MFAToken)
+	validateSecondFactorInput(v, input.Code, input.RecoveryCode)
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Tokens.ConsumeForToken(data.ScopeMFAPending, input.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.secondFactorLocked(w, r, user) {
+		return
+	}
+
+	twoFactor, err := app.Models.TwoFactor.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(twoFactor, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.recordLoginFailure(r, user.Username)
+
+		token, err := app.Models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFAPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env := envelope{"error": "invalid credentials", "mfa_token": token}
+
+		err = app.writeJSON(w, http.StatusUnauthorized, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Throttles.Reset(usernameThrottleKey(user.Username))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.issueSessionTokens(w, r, user)
+}
+
+// secondFactorLocked reports whether the user or client is locked out of
+// logging in, writing the error response if so. Wrong codes count towards
+// the same lockouts as wrong passwords. user must have been loaded from the
+// database, not taken from a signed token, so its username is set.
+func (app *Application) secondFactorLocked(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	lockedFor, err := app.Models.Throttles.LockedFor(
+		usernameThrottleKey(user.Username),
+		ipThrottleKey(app.clientIP(r)),
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return true
+	}
+
+	if lockedFor > 0 {
+		app.loginLockedResponse(w, r, lockedFor)
+		return true
+	}
+
+	return false
+}
+
+// verifySecondFactor accepts either a TOTP code that hasn't been used before
+// or an unused recovery code.
+func (app *Application) verifySecondFactor(twoFactor *data.TwoFactor, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		err := app.Models.TwoFactor.UseRecoveryCode(twoFactor.UserID, recoveryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				return false, nil
+			default:
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	err := app.Models.TwoFactor.UseStep(twoFactor.UserID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCodeReused):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func validateSecondFactorInput(v *validator.Validator, code, recoveryCode string) {
+	v.Check(code != "" || recoveryCode != "", "code", "code or recovery_code is required")
+	v.Check(code == "" || recoveryCode == "", "code", "provide either code or recovery_code, not both")
+}
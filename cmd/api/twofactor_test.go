@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/jsonlog"
+	"github.com/kharljhon14/starbloom-server/internal/totp"
+)
+
+// testDB connects to the migrated database named by STARBLOOM_TEST_DB_DSN,
+// skipping the test when it isn't set.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("STARBLOOM_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("STARBLOOM_TEST_DB_DSN not set")
+	}
+
+	db, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+// wrongCode returns a code that isn't valid for secret around now.
+func wrongCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	for i := 0; ; i++ {
+		code := fmt.Sprintf("%06d", i)
+		if _, ok := totp.Validate(secret, code, time.Now(), 1); !ok {
+			return code
+		}
+	}
+}
+
+func TestConfirmTwoFactorEnrollmentWithSignedTokenUser(t *testing.T) {
+	db := testDB(t)
+
+	app := &Application{
+		Logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		Models: data.NewModels(db),
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	user := &data.User{
+		Username:  "tfa_" + suffix,
+		Email:     "tfa_" + suffix + "@example.com",
+		FirstName: "Two",
+		LastName:  "Factor",
+	}
+
+	err := user.Password.Set("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usernameKey := usernameThrottleKey(user.Username)
+
+	t.Cleanup(func() {
+		app.Models.Throttles.Reset(usernameKey, usernameThrottleKey(""), ipThrottleKey("192.0.2.1"))
+		db.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.Models.TwoFactor.SetPendingSecret(user.ID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]string{"code": wrongCode(t, secret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/2fa/confirm", bytes.NewReader(body))
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	// A signed token only identifies the user and their activation
+	r = app.setContextUser(r, &data.User{ID: user.ID, Activated: true})
+
+	w := httptest.NewRecorder()
+
+	app.confirmTwoFactorEnrollmentHandler(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	failures := func(key string) int {
+		var n int
+
+		err := db.QueryRow(context.Background(), `SELECT COALESCE(MAX(failures), 0) FROM login_throttles WHERE key = $1`, key).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return n
+	}
+
+	if n := failures(usernameKey); n != 1 {
+		t.Errorf("failures against %s: got %d, want 1", usernameKey, n)
+	}
+
+	if n := failures(usernameThrottleKey("")); n != 0 {
+		t.Errorf("failures against the empty username: got %d, want 0", n)
+	}
+}
@@ -2,7 +2,11 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/kharljhon14/starbloom-server/internal/data"
 	"github.com/kharljhon14/starbloom-server/internal/validator"
@@ -59,7 +63,80 @@ func (app *Application) createUserHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
+	token, err := app.Models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"firstName":       user.FirstName,
+			"activationToken": token.PlainText,
+		}
+
+		err := app.Mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err.Error(), nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user.Self()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Tokens.GetForToken(data.ScopeActivation, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.validationErrorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = app.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Self()}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -69,6 +146,35 @@ func (app *Application) getUserhandler(w http.ResponseWriter, r *http.Request) {
 	username := r.PathValue("username")
 
 	user, err := app.Models.Users.GetUser(username)
+	if errors.Is(err, data.ErrNoRecordFound) {
+		// Old links keep working while a retired username is held for its
+		// previous owner. The response carries the current username so
+		// clients can redirect.
+		user, err = app.Models.Users.GetByRetiredUsername(username)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundErrorResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Users who blocked the viewer look the same as users who don't exist
+	blocked, err := app.Models.Blocks.Exists(user.ID, app.getContextUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if blocked {
+		app.notFoundErrorResponse(w, r)
+		return
+	}
+
+	stats, relationship, err := app.Models.Users.GetStats(user.ID, app.getContextUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
@@ -79,7 +185,407 @@ func (app *Application) getUserhandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	env := envelope{
+		"user":         user.Public(),
+		"stats":        stats,
+		"relationship": relationship,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+		Token    string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePlainTextPassword(v, input.Password)
+	data.ValidateTokenPlainText(v, input.Token)
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Tokens.GetForToken(data.ScopePasswordReset, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.validationErrorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Resetting the password is how users stop an email change they didn't
+	// ask for, as the email change notice tells them
+	err = app.Models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A password reset also signs the user out of every existing session
+	err = app.Models.Tokens.DeleteAllSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.reloadRevocations()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Password != "", "password", "password is required"); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password) {
+		return
+	}
+
+	requestedAt, err := app.Models.Users.ScheduleDeletion(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Tokens.DeleteEverythingForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.reloadRevocations()
+
+	purgeAt := requestedAt.Add(app.Config.DeletionGracePeriod)
+
+	app.background(func() {
+		data := map[string]any{
+			"firstName": user.FirstName,
+			"purgeAt":   purgeAt.Format(time.RFC1123),
+		}
+
+		err := app.Mailer.Send(user.Email, "account_deletion_scheduled.tmpl", data)
+		if err != nil {
+			app.Logger.PrintError(err.Error(), nil)
+		}
+	})
+
+	env := envelope{
+		"message":  "your account will be deleted unless you log in again before purge_at",
+		"purge_at": purgeAt,
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		FirstName *string `json:"first_name"`
+		LastName  *string `json:"last_name"`
+		Bio       *string `json:"bio"`
+		Website   *string `json:"website"`
+		AvatarURL *string `json:"avatar_url"`
+		IsPrivate *bool   `json:"is_private"`
+		Privacy   struct {
+			ShowEmail     *bool `json:"show_email"`
+			ShowBio       *bool `json:"show_bio"`
+			ShowWebsite   *bool `json:"show_website"`
+			ShowCreatedAt *bool `json:"show_created_at"`
+		} `json:"privacy"`
+		// Version must match the version the client last read, unless it
+		// is sent in an If-Match header instead
+		Version *int `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.checkVersion(w, r, input.Version, user.Version) {
+		return
+	}
+
+	if input.FirstName != nil {
+		user.FirstName = strings.TrimSpace(*input.FirstName)
+	}
+
+	if input.LastName != nil {
+		user.LastName = strings.TrimSpace(*input.LastName)
+	}
+
+	if input.Bio != nil {
+		user.Bio = strings.TrimSpace(*input.Bio)
+	}
+
+	if input.Website != nil {
+		user.Website = strings.TrimSpace(*input.Website)
+	}
+
+	if input.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*input.AvatarURL)
+	}
+
+	wasPrivate := user.IsPrivate
+
+	if input.IsPrivate != nil {
+		user.IsPrivate = *input.IsPrivate
+	}
+
+	if input.Privacy.ShowEmail != nil {
+		user.Privacy.ShowEmail = *input.Privacy.ShowEmail
+	}
+
+	if input.Privacy.ShowBio != nil {
+		user.Privacy.ShowBio = *input.Privacy.ShowBio
+	}
+
+	if input.Privacy.ShowWebsite != nil {
+		user.Privacy.ShowWebsite = *input.Privacy.ShowWebsite
+	}
+
+	if input.Privacy.ShowCreatedAt != nil {
+		user.Privacy.ShowCreatedAt = *input.Privacy.ShowCreatedAt
+	}
+
+	v := validator.New()
+
+	if data.ValidateProfile(v, user); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Pending requests have nothing left to wait for once the account is
+	// public
+	if wasPrivate && !user.IsPrivate {
+		err = app.Models.FollowRequests.ApproveAll(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Self()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) changeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.Models.Users.GetByID(app.getContextUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Username string `json:"username"`
+		// Version must match the version the client last read, unless it
+		// is sent in an If-Match header instead
+		Version *int `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.checkVersion(w, r, input.Version, user.Version) {
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateUsername(v, input.Username)
+	v.Check(input.Username != user.Username, "username", "must differ from the current username")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Users.Rename(user, input.Username, app.Config.Usernames.ChangeCooldown, app.Config.Usernames.HoldPeriod)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateUsername):
+			v.AddError("username", "username already taken")
+			app.validationErrorResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUsernameChangeTooSoon):
+			days := int(app.Config.Usernames.ChangeCooldown.Hours() / 24)
+			v.AddError("username", fmt.Sprintf("username can only be changed once every %d days", days))
+			app.validationErrorResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Cached tokens still carry the old username
+	app.Models.Tokens.Cache.DeleteUser(user.ID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user.Self()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		data.Filter
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = strings.TrimSpace(qs.Get("q"))
+	input.Filter.Page = app.readInt(qs, "page", 1, v)
+	input.Filter.PageSize = app.readInt(qs, "pageSize", 20, v)
+
+	v.Check(utf8.RuneCountInString(input.Query) >= 3, "q", "q must be at least 3 characters")
+	v.Check(len(input.Query) <= 100, "q", "q must not exceed 100 characters")
+	v.Check(input.Filter.PageSize <= 100, "page_size", "page_size must be a maximum of 100")
+
+	if data.ValidateFilters(v, input.Filter); !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.Models.Users.Search(input.Query, app.getContextUser(r).ID, input.Filter)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"_metadata": metadata, "users": users}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 10, v)
+
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 50, "limit", "must be a maximum of 50")
+
+	if !v.Valid() {
+		app.validationErrorResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.Models.Users.GetSuggestions(app.getContextUser(r).ID, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
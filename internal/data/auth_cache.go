@@ -0,0 +1,224 @@
+package data
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuthCache remembers which user and permissions a token resolved to so
+// repeat requests with the same token skip the database. TokenModel evicts
+// entries whenever it deletes tokens, but only in its own process: other
+// instances keep serving a revoked token until their entry expires, so the
+// TTL is also the longest a revocation can take to reach every instance. Set
+// it to zero where that window isn't acceptable. A nil *AuthCache caches
+// nothing.
+type AuthCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]authCacheEntry
+	byUser  map[int64]map[[sha256.Size]byte]struct{}
+	// generation counts evictions. A lookup that started before an
+	// eviction may have read a token that has since been deleted, so Set
+	// drops entries read under an older generation.
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type authCacheEntry struct {
+	user        User
+	permissions Permissions
+	expiresAt   time.Time
+}
+
+type AuthCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// NewAuthCache returns a cache holding up to maxEntries tokens for at most
+// ttl each. It returns nil, disabling caching, if either is zero.
+func NewAuthCache(ttl time.Duration, maxEntries int) *AuthCache {
+	if ttl <= 0 || maxEntries <= 0 {
+		return nil
+	}
+
+	return &AuthCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]authCacheEntry),
+		byUser:     make(map[int64]map[[sha256.Size]byte]struct{}),
+	}
+}
+
+// Get returns a copy of the cached user along with the token's permissions.
+func (c *AuthCache) Get(tokenPlainText string) (*User, Permissions, bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+
+	hash := sha256.Sum256([]byte(tokenPlainText))
+
+	c.mu.Lock()
+	entry, ok := c.entries[hash]
+	if ok && !time.Now().Before(entry.expiresAt) {
+		c.remove(hash, entry.user.ID)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return nil, nil, false
+	}
+
+	c.hits.Add(1)
+
+	user := entry.user
+	return &user, entry.permissions, true
+}
+
+// Generation returns the current eviction generation. Callers read it
+// before looking a token up in the database and pass it to Set.
+func (c *AuthCache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// Set caches the user a token resolved to, unless anything was evicted since
+// generation was read. The entry never outlives the token's own expiry.
+func (c *AuthCache) Set(generation uint64, tokenPlainText string, user *User, permissions Permissions, tokenExpiredAt time.Time) {
+	if c == nil {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+	if tokenExpiredAt.Before(expiresAt) {
+		expiresAt = tokenExpiredAt
+	}
+
+	hash := sha256.Sum256([]byte(tokenPlainText))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if _, ok := c.entries[hash]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+
+	c.entries[hash] = authCacheEntry{
+		user:        *user,
+		permissions: permissions,
+		expiresAt:   expiresAt,
+	}
+
+	if c.byUser[user.ID] == nil {
+		c.byUser[user.ID] = make(map[[sha256.Size]byte]struct{})
+	}
+	c.byUser[user.ID][hash] = struct{}{}
+}
+
+// Delete evicts a single token.
+func (c *AuthCache) Delete(tokenHash [sha256.Size]byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	if entry, ok := c.entries[tokenHash]; ok {
+		c.remove(tokenHash, entry.user.ID)
+	}
+}
+
+// DeleteUser evicts every token belonging to the user.
+func (c *AuthCache) DeleteUser(userID int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for hash := range c.byUser[userID] {
+		delete(c.entries, hash)
+	}
+	delete(c.byUser, userID)
+}
+
+func (c *AuthCache) Stats() AuthCacheStats {
+	if c == nil {
+		return AuthCacheStats{}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return AuthCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// evict makes room for new entries, dropping expired entries first and a
+// tenth of the cache at random if that wasn't enough, so a full cache isn't
+// swept on every insert. The caller must hold c.mu.
+func (c *AuthCache) evict() {
+	now := time.Now()
+
+	for hash, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			c.remove(hash, entry.user.ID)
+		}
+	}
+
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+
+	n := c.maxEntries/10 + 1
+
+	for hash, entry := range c.entries {
+		if n == 0 {
+			return
+		}
+
+		c.remove(hash, entry.user.ID)
+		n--
+	}
+}
+
+// remove deletes an entry from both maps. The caller must hold c.mu.
+func (c *AuthCache) remove(hash [sha256.Size]byte, userID int64) {
+	delete(c.entries, hash)
+
+	if hashes, ok := c.byUser[userID]; ok {
+		delete(hashes, hash)
+		if len(hashes) == 0 {
+			delete(c.byUser, userID)
+		}
+	}
+}
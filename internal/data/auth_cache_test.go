@@ -0,0 +1,36 @@
+package data
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestAuthCacheDropsStaleSet(t *testing.T) {
+	cache := NewAuthCache(time.Minute, 10)
+	user := &User{ID: 1}
+	expiry := time.Now().Add(time.Hour)
+
+	// A logout lands between the database read and the cache write
+	generation := cache.Generation()
+	cache.Delete(sha256.Sum256([]byte("token")))
+	cache.Set(generation, "token", user, SessionPermissions, expiry)
+
+	if _, _, ok := cache.Get("token"); ok {
+		t.Error("token deleted during the lookup was cached")
+	}
+
+	generation = cache.Generation()
+	cache.DeleteUser(user.ID)
+	cache.Set(generation, "token", user, SessionPermissions, expiry)
+
+	if _, _, ok := cache.Get("token"); ok {
+		t.Error("token of a user evicted during the lookup was cached")
+	}
+
+	cache.Set(cache.Generation(), "token", user, SessionPermissions, expiry)
+
+	if _, _, ok := cache.Get("token"); !ok {
+		t.Error("token looked up without any eviction wasn't cached")
+	}
+}
@@ -0,0 +1,194 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrAlreadyBlocked = errors.New("already blocked")
+
+type Block struct {
+	BlockerID int64     `json:"blocker_id"`
+	BlockedID int64     `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BlockedUser struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BlockModel struct {
+	DB *pgxpool.Pool
+}
+
+// Insert blocks blockedID on behalf of blockerID and removes any follows and
+// follow requests between the two in either direction.
+func (m BlockModel) Insert(blockerID, blockedID int64) (*Block, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	block := Block{
+		BlockerID: blockerID,
+		BlockedID: blockedID,
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) RETURNING created_at`,
+		blockerID,
+		blockedID,
+	).Scan(&block.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "blocks_pkey":
+			return nil, ErrAlreadyBlocked
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "blocks_blocked_id_fkey":
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	queries := []string{
+		`DELETE FROM follows WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)`,
+		`DELETE FROM follow_requests WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)`,
+	}
+
+	for _, query := range queries {
+		_, err = tx.Exec(ctx, query, blockerID, blockedID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+func (m BlockModel) Delete(blockerID, blockedID int64) error {
+	query := `DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// Exists reports whether blockerID has blocked blockedID.
+func (m BlockModel) Exists(blockerID, blockedID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := m.DB.QueryRow(ctx, query, blockerID, blockedID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Between reports whether either user has blocked the other.
+func (m BlockModel) Between(a, b int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2)
+			OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := m.DB.QueryRow(ctx, query, a, b).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// GetBlocked lists the users blockerID has blocked, most recent first.
+func (m BlockModel) GetBlocked(blockerID int64, filters Filter) ([]*BlockedUser, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), u.id, u.username, u.first_name, u.last_name, b.created_at
+		FROM blocks b
+		INNER JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, blockerID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*BlockedUser{}
+
+	for rows.Next() {
+		var user BlockedUser
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.UserID,
+			&user.Username,
+			&user.FirstName,
+			&user.LastName,
+			&user.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
@@ -110,19 +110,39 @@ func (c CommentModel) Get(commentID int64) (*CommentWithUser, error) {
 	return &comment, nil
 }
 
-func (c CommentModel) GetCommentsByPost(postID int64, filters Filter) ([]*CommentWithUser, Metadata, error) {
+// GetCommentsByPost lists the comments on a post, leaving out comments by
+// anyone who has blocked or been blocked by viewerID, comments by users they
+// muted and comments matching their muted keywords.
+func (c CommentModel) GetCommentsByPost(postID, viewerID int64, filters Filter) ([]*CommentWithUser, Metadata, error) {
 	query := fmt.Sprintf(`
-			WITH total AS (
-				SELECT COUNT(*) AS total_count FROM comments WHERE post_id = $1
+			WITH visible AS (
+				SELECT c.id, c.post_id, c.user_id, c.comment, c.created_at, c.updated_at,
+				u.username, u.first_name, u.last_name
+				FROM comments c
+				INNER JOIN users u ON c.user_id = u.id
+				WHERE c.post_id = $1 AND u.deletion_requested_at IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM blocks b
+					WHERE (b.blocker_id = c.user_id AND b.blocked_id = $4)
+					OR (b.blocker_id = $4 AND b.blocked_id = c.user_id)
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM muted_users m
+					WHERE m.user_id = $4 AND m.muted_id = c.user_id
+					AND (m.expires_at IS NULL OR m.expires_at > NOW())
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM muted_keywords k
+					WHERE k.user_id = $4 AND c.user_id <> $4
+					AND (k.expires_at IS NULL OR k.expires_at > NOW())
+					AND strpos(lower(c.comment), k.keyword) > 0
+				)
 			)
 			SELECT 
-				total.total_count,
+				(SELECT COUNT(*) FROM visible),
 				c.id, c.post_id, c.user_id, c.comment, c.created_at, c.updated_at,
-				u.username, u.first_name, u.last_name
-			FROM comments c
-			INNER JOIN users u ON c.user_id = u.id
-			CROSS JOIN total
-			WHERE c.post_id = $1
+				c.username, c.first_name, c.last_name
+			FROM visible c
 			ORDER BY c.created_at %s
 			LIMIT $2 OFFSET $3;
 		`, filters.sort())
@@ -130,7 +150,7 @@ func (c CommentModel) GetCommentsByPost(postID int64, filters Filter) ([]*Commen
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.Query(ctx, query, postID, filters.limit(), filters.offset())
+	rows, err := c.DB.Query(ctx, query, postID, filters.limit(), filters.offset(), viewerID)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
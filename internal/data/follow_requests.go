@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrAlreadyRequested = errors.New("follow already requested")
+
+type FollowRequest struct {
+	UserID      int64     `json:"user_id"`
+	RequesterID int64     `json:"requester_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type FollowRequestWithUser struct {
+	RequesterID int64     `json:"requester_id"`
+	Username    string    `json:"username"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type FollowRequestModel struct {
+	DB *pgxpool.Pool
+}
+
+// Insert asks userID to approve requesterID as a follower. It fails with
+// ErrAlreadyFollowing if the follow already exists.
+func (m FollowRequestModel) Insert(userID, requesterID int64) (*FollowRequest, error) {
+	query := `
+	INSERT INTO follow_requests (user_id, requester_id)
+	SELECT $1, $2
+	WHERE NOT EXISTS (SELECT 1 FROM follows WHERE user_id = $1 AND follower_id = $2)
+	RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	request := FollowRequest{
+		UserID:      userID,
+		RequesterID: requesterID,
+	}
+
+	err := m.DB.QueryRow(ctx, query, userID, requesterID).Scan(&request.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrAlreadyFollowing
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "follow_requests_pkey":
+			return nil, ErrAlreadyRequested
+		default:
+			return nil, err
+		}
+	}
+
+	return &request, nil
+}
+
+// GetForUser lists the pending requests to follow userID, oldest first.
+func (m FollowRequestModel) GetForUser(userID int64, filters Filter) ([]*FollowRequestWithUser, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), u.id, u.username, u.first_name, u.last_name, r.created_at
+		FROM follow_requests r
+		INNER JOIN users u ON u.id = r.requester_id
+		WHERE r.user_id = $1
+		ORDER BY r.created_at, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	requests := []*FollowRequestWithUser{}
+
+	for rows.Next() {
+		var request FollowRequestWithUser
+
+		err := rows.Scan(
+			&totalRecords,
+			&request.RequesterID,
+			&request.Username,
+			&request.FirstName,
+			&request.LastName,
+			&request.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		requests = append(requests, &request)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return requests, metadata, nil
+}
+
+// Approve turns a pending request into a follow.
+func (m FollowRequestModel) Approve(userID, requesterID int64) (*Follow, error) {
+	query := `
+	WITH request AS (
+		DELETE FROM follow_requests
+		WHERE user_id = $1 AND requester_id = $2
+		RETURNING user_id, requester_id
+	)
+	INSERT INTO follows (user_id, follower_id)
+	SELECT user_id, requester_id FROM request
+	ON CONFLICT DO NOTHING
+	RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	follow := Follow{
+		UserID:     userID,
+		FollowerID: requesterID,
+	}
+
+	err := m.DB.QueryRow(ctx, query, userID, requesterID).Scan(&follow.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &follow, nil
+}
+
+// ApproveAll accepts every pending request, used when an account stops being
+// private.
+func (m FollowRequestModel) ApproveAll(userID int64) error {
+	query := `
+	WITH requests AS (
+		DELETE FROM follow_requests
+		WHERE user_id = $1
+		RETURNING user_id, requester_id
+	)
+	INSERT INTO follows (user_id, follower_id)
+	SELECT user_id, requester_id FROM requests
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, userID)
+	return err
+}
+
+// Delete rejects a request, or withdraws it when called by the requester.
+func (m FollowRequestModel) Delete(userID, requesterID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
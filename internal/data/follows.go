@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
@@ -82,23 +83,74 @@ type FollowUser struct {
 	Username  string `json:"username"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	// FollowsYou reports whether this user follows the viewer
+	FollowsYou bool `json:"follows_you"`
 }
 
-func (f FollowsModel) GetFollowers(userID int64, filters Filter) ([]*FollowUser, Metadata, error) {
-	query := `
-		WITH total AS(
-			SELECT COUNT(*) AS total_count FROM follows WHERE user_id = $1
+// GetFollowers lists the followers of userID, leaving out anyone who has
+// blocked or been blocked by viewerID.
+func (f FollowsModel) GetFollowers(userID, viewerID int64, filters Filter) ([]*FollowUser, Metadata, error) {
+	edges := `
+		SELECT f.follower_id AS user_id, f.created_at FROM follows f
+		WHERE f.user_id = $1
+	`
+
+	return f.listFollowUsers(edges, userID, viewerID, filters)
+}
+
+// GetFollowing lists the users userID follows, leaving out anyone who has
+// blocked or been blocked by viewerID.
+func (f FollowsModel) GetFollowing(userID, viewerID int64, filters Filter) ([]*FollowUser, Metadata, error) {
+	edges := `
+		SELECT f.user_id, f.created_at FROM follows f
+		WHERE f.follower_id = $1
+	`
+
+	return f.listFollowUsers(edges, userID, viewerID, filters)
+}
+
+// GetMutuals lists the users who follow userID and are followed back, leaving
+// out anyone who has blocked or been blocked by viewerID.
+func (f FollowsModel) GetMutuals(userID, viewerID int64, filters Filter) ([]*FollowUser, Metadata, error) {
+	edges := `
+		SELECT f.user_id, GREATEST(f.created_at, back.created_at) AS created_at FROM follows f
+		INNER JOIN follows back ON back.user_id = f.follower_id AND back.follower_id = f.user_id
+		WHERE f.follower_id = $1
+	`
+
+	return f.listFollowUsers(edges, userID, viewerID, filters)
+}
+
+// listFollowUsers pages through the users selected by edges, a query over
+// follows returning user_id and created_at for userID ($1). The most recent
+// connections come first.
+func (f FollowsModel) listFollowUsers(edges string, userID, viewerID int64, filters Filter) ([]*FollowUser, Metadata, error) {
+	query := fmt.Sprintf(`
+		WITH edges AS (%s),
+		visible AS (
+			SELECT e.user_id, e.created_at FROM edges e
+			WHERE NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = e.user_id AND b.blocked_id = $4)
+				OR (b.blocker_id = $4 AND b.blocked_id = e.user_id)
+			)
+		),
+		total AS(
+			SELECT COUNT(*) AS total_count FROM visible
 		)
-		SELECT total.total_count, u.id, u.username, u.first_name, u.last_name from users
-		u INNER JOIN follows f ON u.id = f.follower_id
+		SELECT total.total_count, u.id, u.username, u.first_name, u.last_name,
+		EXISTS (SELECT 1 FROM follows WHERE user_id = $4 AND follower_id = u.id) AS follows_you
+		FROM users u
+		INNER JOIN visible v ON u.id = v.user_id
 		CROSS JOIN total
-		WHERE user_id = $1 LIMIT $2 OFFSET $3
-	`
+		ORDER BY v.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`, edges)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, filters.limit(), filters.offset()}
+	args := []any{userID, filters.limit(), filters.offset(), viewerID}
 
 	rows, err := f.DB.Query(ctx, query, args...)
 	if err != nil {
@@ -109,11 +161,6 @@ func (f FollowsModel) GetFollowers(userID int64, filters Filter) ([]*FollowUser,
 	totalRecords := 0
 	users := []*FollowUser{}
 
-	// users, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByPos[FollowUser])
-	// if err != nil {
-	// 	return nil, Metadata{}, err
-	// }
-
 	for rows.Next() {
 		var user FollowUser
 
@@ -123,6 +170,7 @@ func (f FollowsModel) GetFollowers(userID int64, filters Filter) ([]*FollowUser,
 			&user.Username,
 			&user.FirstName,
 			&user.LastName,
+			&user.FollowsYou,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -140,10 +188,33 @@ func (f FollowsModel) GetFollowers(userID int64, filters Filter) ([]*FollowUser,
 	return users, metadata, nil
 }
 
+// GetFollowingPosts returns userID's home feed. Posts from blocked and muted
+// users and posts matching muted keywords are filtered out in the query so
+// they don't take up page slots.
 func (f FollowsModel) GetFollowingPosts(userID int64, filters Filter) ([]*PostWithUser, Metadata, error) {
 	query := `
-		WITH total AS(
-			SELECT COUNT(*) AS total_count FROM posts WHERE user_id IN (SELECT user_id FROM follows WHERE follower_id = $1)
+		WITH feed AS (
+			SELECT p.id, p.user_id, p.content, p.created_at, p.updated_at,
+			u.username, u.first_name, u.last_name
+			FROM posts p INNER JOIN users u ON p.user_id = u.id
+			WHERE (p.user_id IN (SELECT user_id FROM follows WHERE follower_id = $1) OR p.user_id = $1)
+			AND u.deletion_requested_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = p.user_id AND b.blocked_id = $1)
+				OR (b.blocker_id = $1 AND b.blocked_id = p.user_id)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM muted_users m
+				WHERE m.user_id = $1 AND m.muted_id = p.user_id
+				AND (m.expires_at IS NULL OR m.expires_at > NOW())
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM muted_keywords k
+				WHERE k.user_id = $1 AND p.user_id <> $1
+				AND (k.expires_at IS NULL OR k.expires_at > NOW())
+				AND strpos(lower(p.content), k.keyword) > 0
+			)
 		),
 		like_counts AS(
 			SELECT post_id, COUNT(*) AS like_count
@@ -160,17 +231,15 @@ func (f FollowsModel) GetFollowingPosts(userID int64, filters Filter) ([]*PostWi
 			FROM comments
 			GROUP BY post_id
 		)
-		SELECT total.total_count, p.id, p.user_id, p.content, p.created_at, p.updated_at,
-		u.username, u.first_name, u.last_name, COALESCE(l.like_count, 0) AS like_count,
+		SELECT (SELECT COUNT(*) FROM feed), p.id, p.user_id, p.content, p.created_at, p.updated_at,
+		p.username, p.first_name, p.last_name, COALESCE(l.like_count, 0) AS like_count,
 		CASE WHEN ul.post_id IS NOT NULL THEN true ELSE false END AS liked_by_user,
 		COALESCE(c.comment_count, 0) AS comment_count
-		FROM posts p INNER JOIN users u ON p.user_id = u.id
+		FROM feed p
 		LEFT JOIN like_counts l ON p.id = l.post_id
 		LEFT JOIN user_likes ul ON p.id = ul.post_id
 		LEFT JOIN comment_counts c ON p.id = c.post_id
-		CROSS JOIN total
-		WHERE user_id IN (SELECT user_id FROM follows where follower_id = $1) OR p.user_id = $1
-		ORDER BY created_at DESC LIMIT $2 OFFSET $3
+		ORDER BY p.created_at DESC LIMIT $2 OFFSET $3
 	`
 
 	args := []any{userID, filters.limit(), filters.offset()}
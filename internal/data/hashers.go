@@ -0,0 +1,203 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes and verifies passwords for one algorithm.
+type PasswordHasher interface {
+	Hash(plainText string) ([]byte, error)
+	// Verify reports whether plainText matches hash, and whether hash was
+	// made with different parameters than the hasher currently uses.
+	Verify(hash []byte, plainText string) (match bool, outdated bool, err error)
+	// Recognizes reports whether hash was produced by this algorithm.
+	Recognizes(hash []byte) bool
+	// MaxLength is the longest password in bytes the algorithm fully uses.
+	MaxLength() int
+}
+
+// Argon2idHasher produces PHC formatted hashes such as
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idHasher uses the OWASP recommended minimum parameters.
+var DefaultArgon2idHasher = Argon2idHasher{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var argon2idPrefix = []byte("$argon2id$")
+
+func (h Argon2idHasher) Hash(plainText string) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plainText), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	encoded := fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+func (h Argon2idHasher) Verify(hash []byte, plainText string) (bool, bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(plainText), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	outdated := params.Memory != h.Memory ||
+		params.Iterations != h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		params.SaltLength != h.SaltLength ||
+		params.KeyLength != h.KeyLength
+
+	return true, outdated, nil
+}
+
+func (h Argon2idHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, argon2idPrefix)
+}
+
+func (h Argon2idHasher) MaxLength() int {
+	return 256
+}
+
+func decodeArgon2id(hash []byte) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher produces standard $2a$ bcrypt hashes. bcrypt ignores
+// everything past 72 bytes, which limits how long passwords can be.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(plainText string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plainText), h.Cost)
+}
+
+func (h BcryptHasher) Verify(hash []byte, plainText string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(plainText))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, false, nil
+		default:
+			return false, false, err
+		}
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, cost != h.Cost, nil
+}
+
+func (h BcryptHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) ||
+		bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+func (h BcryptHasher) MaxLength() int {
+	return 72
+}
+
+// passwordHashing holds the hasher new passwords are hashed with, and every
+// hasher existing hashes may have been made with.
+var passwordHashing = struct {
+	current PasswordHasher
+	known   []PasswordHasher
+}{
+	current: DefaultArgon2idHasher,
+	known:   []PasswordHasher{DefaultArgon2idHasher, BcryptHasher{Cost: 12}},
+}
+
+// SetPasswordHasher changes the hasher used for new passwords. Hashes made by
+// other algorithms still verify, and are reported as outdated so they get
+// rehashed on the next login.
+func SetPasswordHasher(current PasswordHasher) {
+	passwordHashing.current = current
+	passwordHashing.known = []PasswordHasher{current, DefaultArgon2idHasher, BcryptHasher{Cost: 12}}
+}
+
+func hasherFor(hash []byte) (PasswordHasher, error) {
+	for _, hasher := range passwordHashing.known {
+		if hasher.Recognizes(hash) {
+			return hasher, nil
+		}
+	}
+
+	return nil, ErrUnknownHashFormat
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	// Cheap parameters keep the test fast; only their differences matter
+	argon2id := Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	cheapBcrypt := BcryptHasher{Cost: bcrypt.MinCost}
+
+	withMemory := argon2id
+	withMemory.Memory = 128
+
+	withIterations := argon2id
+	withIterations.Iterations = 2
+
+	withKeyLength := argon2id
+	withKeyLength.KeyLength = 16
+
+	tests := []struct {
+		name     string
+		hasher   PasswordHasher
+		verifier PasswordHasher
+		outdated bool
+	}{
+		{"argon2id round trip", argon2id, argon2id, false},
+		{"argon2id memory changed", argon2id, withMemory, true},
+		{"argon2id iterations changed", argon2id, withIterations, true},
+		{"argon2id key length changed", argon2id, withKeyLength, true},
+		{"bcrypt round trip", cheapBcrypt, cheapBcrypt, false},
+		{"bcrypt cost changed", cheapBcrypt, BcryptHasher{Cost: bcrypt.MinCost + 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.verifier.Recognizes(hash) {
+				t.Fatalf("hash %q not recognized", hash)
+			}
+
+			match, outdated, err := tt.verifier.Verify(hash, "correct horse battery staple")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !match {
+				t.Error("correct password didn't match")
+			}
+
+			if outdated != tt.outdated {
+				t.Errorf("got outdated %t, want %t", outdated, tt.outdated)
+			}
+
+			match, _, err = tt.verifier.Verify(hash, "wrong password")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if match {
+				t.Error("wrong password matched")
+			}
+		})
+	}
+}
+
+func TestHasherForRecognizesEachFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{"argon2id", DefaultArgon2idHasher},
+		{"bcrypt", BcryptHasher{Cost: bcrypt.MinCost}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hasher, err := hasherFor(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			match, _, err := hasher.Verify(hash, "correct horse battery staple")
+			if err != nil || !match {
+				t.Errorf("got match %t, err %v", match, err)
+			}
+		})
+	}
+
+	if _, err := hasherFor([]byte("plaintext")); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("got %v, want ErrUnknownHashFormat", err)
+	}
+}
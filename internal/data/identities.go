@@ -0,0 +1,224 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrIdentityLinked = errors.New("identity already linked")
+
+// Identity links a user to an account at an external OpenID Connect provider.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState is the per-login data kept between sending the user to the
+// provider and handling the callback.
+type OIDCState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// LinkUserID is set when a signed in user started the flow to link the
+	// provider account to their own
+	LinkUserID *int64
+	ExpiredAt  time.Time
+}
+
+type IdentityModel struct {
+	DB *pgxpool.Pool
+}
+
+func (m IdentityModel) Insert(identity *Identity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertIdentity(ctx, m.DB, identity)
+}
+
+// InsertWithUser creates user and links identity to it in one transaction,
+// so a failed link never leaves a user behind that can't sign in.
+func (m IdentityModel) InsertWithUser(user *User, identity *Identity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+
+	err = insertIdentity(ctx, tx, identity)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func insertIdentity(ctx context.Context, db rowQuerier, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+
+	args := []any{
+		identity.Provider,
+		identity.Subject,
+		identity.UserID,
+		identity.Email,
+	}
+
+	err := db.QueryRow(ctx, query, args...).Scan(&identity.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.ConstraintName {
+			case "user_identities_pkey":
+				return ErrIdentityLinked
+			default:
+				return err
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// GetUser returns the user linked to the provider account.
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.hashed_password, u.first_name, u.last_name, u.activated, u.created_at,
+		u.bio, u.website, u.avatar_url, u.is_private, u.show_email, u.show_bio, u.show_website, u.show_created_at, u.version
+		FROM users u
+		INNER JOIN user_identities i ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRow(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.FirstName,
+		&user.LastName,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// SaveState stores the login state under a hash of the state parameter.
+func (m IdentityModel) SaveState(state string, oidcState *OIDCState) error {
+	hash := sha256.Sum256([]byte(state))
+
+	query := `
+		INSERT INTO oidc_states (hash, provider, nonce, code_verifier, user_id, expired_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{
+		hash[:],
+		oidcState.Provider,
+		oidcState.Nonce,
+		oidcState.CodeVerifier,
+		oidcState.LinkUserID,
+		oidcState.ExpiredAt,
+	}
+
+	_, err := m.DB.Exec(ctx, query, args...)
+	return err
+}
+
+// ConsumeState deletes and returns the login state so each one can only be
+// used for a single callback.
+func (m IdentityModel) ConsumeState(state string) (*OIDCState, error) {
+	hash := sha256.Sum256([]byte(state))
+
+	query := `
+		DELETE FROM oidc_states
+		WHERE hash = $1 AND expired_at > $2
+		RETURNING provider, nonce, code_verifier, user_id, expired_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var oidcState OIDCState
+
+	err := m.DB.QueryRow(ctx, query, hash[:], time.Now()).Scan(
+		&oidcState.Provider,
+		&oidcState.Nonce,
+		&oidcState.CodeVerifier,
+		&oidcState.LinkUserID,
+		&oidcState.ExpiredAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &oidcState, nil
+}
+
+// DeleteExpiredStates removes login states from abandoned sign ins.
+func (m IdentityModel) DeleteExpiredStates() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, `DELETE FROM oidc_states WHERE expired_at <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB connects to the migrated database named by STARBLOOM_TEST_DB_DSN,
+// skipping the test when it isn't set.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("STARBLOOM_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("STARBLOOM_TEST_DB_DSN not set")
+	}
+
+	db, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+func TestConsumeState(t *testing.T) {
+	m := IdentityModel{DB: testDB(t)}
+
+	save := func(state string, expiredAt time.Time) {
+		t.Helper()
+
+		err := m.SaveState(state, &OIDCState{
+			Provider:     "test",
+			Nonce:        "nonce",
+			CodeVerifier: "verifier",
+			ExpiredAt:    expiredAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := "state-" + time.Now().Format(time.RFC3339Nano)
+
+	save(state, time.Now().Add(time.Minute))
+
+	oidcState, err := m.ConsumeState(state)
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+
+	if oidcState.Provider != "test" || oidcState.Nonce != "nonce" || oidcState.CodeVerifier != "verifier" {
+		t.Errorf("unexpected state: %+v", oidcState)
+	}
+
+	_, err = m.ConsumeState(state)
+	if !errors.Is(err, ErrNoRecordFound) {
+		t.Errorf("reused state: got %v, want ErrNoRecordFound", err)
+	}
+
+	expired := state + "-expired"
+
+	save(expired, time.Now().Add(-time.Second))
+
+	_, err = m.ConsumeState(expired)
+	if !errors.Is(err, ErrNoRecordFound) {
+		t.Errorf("expired state: got %v, want ErrNoRecordFound", err)
+	}
+}
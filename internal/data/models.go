@@ -5,21 +5,39 @@ import (
 )
 
 type Models struct {
-	Users    UserModel
-	Tokens   TokenModel
-	Follows  FollowsModel
-	Posts    PostModel
-	Likes    LikeModel
-	Comments CommentModel
+	Users          UserModel
+	Tokens         TokenModel
+	Follows        FollowsModel
+	FollowRequests FollowRequestModel
+	Blocks         BlockModel
+	Mutes          MuteModel
+	Posts          PostModel
+	Likes          LikeModel
+	Comments       CommentModel
+	TwoFactor      TwoFactorModel
+	Throttles      LoginThrottleModel
+	Identities     IdentityModel
+	Sessions       *SessionTracker
+	Revocations    *RevocationList
 }
 
 func NewModels(db *pgxpool.Pool) Models {
+	tokens := TokenModel{DB: db}
+
 	return Models{
-		Users:    UserModel{DB: db},
-		Tokens:   TokenModel{DB: db},
-		Follows:  FollowsModel{DB: db},
-		Posts:    PostModel{DB: db},
-		Likes:    LikeModel{DB: db},
-		Comments: CommentModel{DB: db},
+		Users:          UserModel{DB: db},
+		Tokens:         tokens,
+		Follows:        FollowsModel{DB: db},
+		FollowRequests: FollowRequestModel{DB: db},
+		Blocks:         BlockModel{DB: db},
+		Mutes:          MuteModel{DB: db},
+		Posts:          PostModel{DB: db},
+		Likes:          LikeModel{DB: db},
+		Comments:       CommentModel{DB: db},
+		TwoFactor:      TwoFactorModel{DB: db},
+		Throttles:      LoginThrottleModel{DB: db},
+		Identities:     IdentityModel{DB: db},
+		Sessions:       NewSessionTracker(tokens),
+		Revocations:    NewRevocationList(db),
 	}
 }
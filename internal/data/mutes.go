@@ -0,0 +1,275 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kharljhon14/starbloom-server/internal/validator"
+)
+
+type MutedUser struct {
+	UserID    int64      `json:"user_id"`
+	Username  string     `json:"username"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type MutedKeyword struct {
+	ID        int64      `json:"id"`
+	Keyword   string     `json:"keyword"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// MuteModel stores user and keyword mutes. Mutes only ever change what the
+// muting user sees. Nothing is recorded against the muted user and no
+// endpoint reveals who has muted whom.
+type MuteModel struct {
+	DB *pgxpool.Pool
+}
+
+// NormalizeKeyword returns the form keywords are stored and matched in.
+// Matching is case insensitive.
+func NormalizeKeyword(keyword string) string {
+	return strings.ToLower(strings.TrimSpace(keyword))
+}
+
+func ValidateKeyword(v *validator.Validator, keyword string) {
+	v.Check(keyword != "", "keyword", "keyword is required")
+	v.Check(utf8.RuneCountInString(keyword) <= 100, "keyword", "keyword must not exceed 100 characters")
+}
+
+// MuteUser hides mutedID's posts and comments from userID until expiresAt,
+// or indefinitely if it is nil. Muting someone again replaces the expiry.
+func (m MuteModel) MuteUser(userID, mutedID int64, expiresAt *time.Time) (*MutedUser, error) {
+	query := `
+	WITH muted AS (
+		INSERT INTO muted_users (user_id, muted_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, muted_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		RETURNING muted_id, created_at, expires_at
+	)
+	SELECT u.id, u.username, u.first_name, u.last_name, m.created_at, m.expires_at
+	FROM muted m INNER JOIN users u ON u.id = m.muted_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var muted MutedUser
+
+	err := m.DB.QueryRow(ctx, query, userID, mutedID, expiresAt).Scan(
+		&muted.UserID,
+		&muted.Username,
+		&muted.FirstName,
+		&muted.LastName,
+		&muted.CreatedAt,
+		&muted.ExpiresAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "muted_users_muted_id_fkey" {
+			return nil, ErrNoRecordFound
+		}
+
+		return nil, err
+	}
+
+	return &muted, nil
+}
+
+func (m MuteModel) UnmuteUser(userID, mutedID int64) error {
+	query := `DELETE FROM muted_users WHERE user_id = $1 AND muted_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, userID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// GetMutedUsers lists the users userID currently has muted, most recent
+// first.
+func (m MuteModel) GetMutedUsers(userID int64, filters Filter) ([]*MutedUser, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), u.id, u.username, u.first_name, u.last_name, m.created_at, m.expires_at
+		FROM muted_users m
+		INNER JOIN users u ON u.id = m.muted_id
+		WHERE m.user_id = $1 AND (m.expires_at IS NULL OR m.expires_at > NOW())
+		ORDER BY m.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*MutedUser{}
+
+	for rows.Next() {
+		var user MutedUser
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.UserID,
+			&user.Username,
+			&user.FirstName,
+			&user.LastName,
+			&user.CreatedAt,
+			&user.ExpiresAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// MuteKeyword hides posts and comments containing keyword from userID until
+// expiresAt, or indefinitely if it is nil. The keyword must already be
+// normalized. Muting a keyword again replaces the expiry.
+func (m MuteModel) MuteKeyword(userID int64, keyword string, expiresAt *time.Time) (*MutedKeyword, error) {
+	query := `
+	INSERT INTO muted_keywords (user_id, keyword, expires_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, keyword) DO UPDATE SET expires_at = EXCLUDED.expires_at
+	RETURNING id, keyword, created_at, expires_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var muted MutedKeyword
+
+	err := m.DB.QueryRow(ctx, query, userID, keyword, expiresAt).Scan(
+		&muted.ID,
+		&muted.Keyword,
+		&muted.CreatedAt,
+		&muted.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &muted, nil
+}
+
+func (m MuteModel) UnmuteKeyword(userID, id int64) error {
+	query := `DELETE FROM muted_keywords WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// GetMutedKeywords lists the keywords userID currently has muted.
+func (m MuteModel) GetMutedKeywords(userID int64) ([]*MutedKeyword, error) {
+	query := `
+	SELECT id, keyword, created_at, expires_at
+	FROM muted_keywords
+	WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+	ORDER BY keyword
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keywords := []*MutedKeyword{}
+
+	for rows.Next() {
+		var keyword MutedKeyword
+
+		err := rows.Scan(
+			&keyword.ID,
+			&keyword.Keyword,
+			&keyword.CreatedAt,
+			&keyword.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keywords = append(keywords, &keyword)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keywords, nil
+}
+
+// DeleteExpired removes up to limit expired user and keyword mutes. Expired
+// mutes are already ignored, this just keeps the tables small.
+func (m MuteModel) DeleteExpired(limit int) (int64, error) {
+	queries := []string{
+		`DELETE FROM muted_users WHERE ctid IN (
+			SELECT ctid FROM muted_users WHERE expires_at <= $1 LIMIT $2
+		)`,
+		`DELETE FROM muted_keywords WHERE id IN (
+			SELECT id FROM muted_keywords WHERE expires_at <= $1 LIMIT $2
+		)`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var total int64
+
+	for _, query := range queries {
+		res, err := m.DB.Exec(ctx, query, time.Now(), limit)
+		if err != nil {
+			return total, err
+		}
+
+		total += res.RowsAffected()
+	}
+
+	return total, nil
+}
@@ -0,0 +1,52 @@
+package data
+
+import "slices"
+
+const (
+	PermissionUsersRead     = "users:read"
+	PermissionUsersWrite    = "users:write"
+	PermissionPostsRead     = "posts:read"
+	PermissionPostsWrite    = "posts:write"
+	PermissionCommentsRead  = "comments:read"
+	PermissionCommentsWrite = "comments:write"
+	PermissionLikesRead     = "likes:read"
+	PermissionLikesWrite    = "likes:write"
+	PermissionFollowsRead   = "follows:read"
+	PermissionFollowsWrite  = "follows:write"
+	PermissionBlocksRead    = "blocks:read"
+	PermissionBlocksWrite   = "blocks:write"
+	PermissionMutesRead     = "mutes:read"
+	PermissionMutesWrite    = "mutes:write"
+
+	// PermissionAccount covers managing the account itself: sessions,
+	// passwords, two-factor settings and access tokens. It is only held by
+	// interactive sessions and can't be granted to personal access tokens.
+	PermissionAccount = "account"
+)
+
+// GrantablePermissions are the permissions a personal access token may hold.
+var GrantablePermissions = Permissions{
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionPostsRead,
+	PermissionPostsWrite,
+	PermissionCommentsRead,
+	PermissionCommentsWrite,
+	PermissionLikesRead,
+	PermissionLikesWrite,
+	PermissionFollowsRead,
+	PermissionFollowsWrite,
+	PermissionBlocksRead,
+	PermissionBlocksWrite,
+	PermissionMutesRead,
+	PermissionMutesWrite,
+}
+
+// SessionPermissions are held by tokens issued through logging in.
+var SessionPermissions = append(slices.Clone(GrantablePermissions), PermissionAccount)
+
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
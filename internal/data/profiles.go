@@ -0,0 +1,101 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PrivacySettings choose which optional fields other users see on a
+// profile.
+type PrivacySettings struct {
+	ShowEmail     bool `json:"show_email"`
+	ShowBio       bool `json:"show_bio"`
+	ShowWebsite   bool `json:"show_website"`
+	ShowCreatedAt bool `json:"show_created_at"`
+}
+
+// PublicProfile is what other users see of a user. Optional fields are left
+// out unless the user's privacy settings show them.
+type PublicProfile struct {
+	ID        int64      `json:"id"`
+	Username  string     `json:"username"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	AvatarURL string     `json:"avatar_url"`
+	IsPrivate bool       `json:"is_private"`
+	Email     string     `json:"email,omitempty"`
+	Bio       string     `json:"bio,omitempty"`
+	Website   string     `json:"website,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// SelfProfile is what users see of their own account.
+type SelfProfile struct {
+	ID        int64           `json:"id"`
+	Username  string          `json:"username"`
+	Email     string          `json:"email"`
+	FirstName string          `json:"first_name"`
+	LastName  string          `json:"last_name"`
+	Bio       string          `json:"bio"`
+	Website   string          `json:"website"`
+	AvatarURL string          `json:"avatar_url"`
+	IsPrivate bool            `json:"is_private"`
+	Privacy   PrivacySettings `json:"privacy"`
+	Activated bool            `json:"activated"`
+	CreatedAt time.Time       `json:"created_at"`
+	Version   int             `json:"version"`
+}
+
+func (u *User) Public() PublicProfile {
+	profile := PublicProfile{
+		ID:        u.ID,
+		Username:  u.Username,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		AvatarURL: u.AvatarURL,
+		IsPrivate: u.IsPrivate,
+	}
+
+	if u.Privacy.ShowEmail {
+		profile.Email = u.Email
+	}
+
+	if u.Privacy.ShowBio {
+		profile.Bio = u.Bio
+	}
+
+	if u.Privacy.ShowWebsite {
+		profile.Website = u.Website
+	}
+
+	if u.Privacy.ShowCreatedAt {
+		createdAt := u.CreatedAt
+		profile.CreatedAt = &createdAt
+	}
+
+	return profile
+}
+
+func (u *User) Self() SelfProfile {
+	return SelfProfile{
+		ID:        u.ID,
+		Username:  u.Username,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Bio:       u.Bio,
+		Website:   u.Website,
+		AvatarURL: u.AvatarURL,
+		IsPrivate: u.IsPrivate,
+		Privacy:   u.Privacy,
+		Activated: u.Activated,
+		CreatedAt: u.CreatedAt,
+		Version:   u.Version,
+	}
+}
+
+// MarshalJSON encodes the public profile, so handlers have to ask for the
+// self view explicitly.
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Public())
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// SessionTracker buffers session last-used times in memory so authenticated
+// requests don't each cost a database write. Flush persists them in one batch.
+type SessionTracker struct {
+	tokens  TokenModel
+	mu      sync.Mutex
+	pending map[[sha256.Size]byte]time.Time
+}
+
+func NewSessionTracker(tokens TokenModel) *SessionTracker {
+	return &SessionTracker{
+		tokens:  tokens,
+		pending: make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+func (s *SessionTracker) Touch(tokenPlainText string) {
+	hash := sha256.Sum256([]byte(tokenPlainText))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[hash] = time.Now()
+}
+
+func (s *SessionTracker) Flush() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[[sha256.Size]byte]time.Time)
+	s.mu.Unlock()
+
+	err := s.tokens.TouchSessions(pending)
+	if err != nil {
+		// Put the timestamps back so they're retried on the next flush,
+		// keeping any newer value recorded in the meantime
+		s.mu.Lock()
+		for hash, usedAt := range pending {
+			if newer, ok := s.pending[hash]; !ok || newer.Before(usedAt) {
+				s.pending[hash] = usedAt
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	return err
+}
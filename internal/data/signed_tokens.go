@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const signedTokenPrefix = "sb1"
+
+var ErrInvalidSignedToken = errors.New("invalid signed token")
+
+// SignedClaims are carried inside a signed token so it can be validated
+// without a database lookup.
+type SignedClaims struct {
+	UserID    int64  `json:"uid"`
+	Scope     string `json:"scp"`
+	Activated bool   `json:"act"`
+	ExpiredAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+// TokenSigner issues and verifies HMAC-SHA256 signed tokens of the form
+// sb1.<key id>.<claims>.<signature>. Every configured key is accepted for
+// verification but only the active key signs, so keys can be rotated by
+// adding a new key, making it active, and removing the old one once its
+// tokens have expired.
+type TokenSigner struct {
+	keys      map[string][]byte
+	activeKID string
+}
+
+func NewTokenSigner(keys map[string][]byte, activeKID string) (*TokenSigner, error) {
+	if _, ok := keys[activeKID]; !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", activeKID)
+	}
+
+	for kid, key := range keys {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("signing key %q must be at least 32 bytes", kid)
+		}
+	}
+
+	return &TokenSigner{
+		keys:      keys,
+		activeKID: activeKID,
+	}, nil
+}
+
+// ParseSigningKeys parses a comma separated list of <key id>:<base64 secret>
+// pairs.
+func ParseSigningKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kid, encoded, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || strings.Contains(kid, ".") {
+			return nil, fmt.Errorf("invalid signing key %q", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %q: %w", kid, err)
+		}
+
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+func IsSignedToken(tokenPlainText string) bool {
+	return strings.HasPrefix(tokenPlainText, signedTokenPrefix+".")
+}
+
+func (s *TokenSigner) Sign(userID int64, activated bool, ttl time.Duration, scope string) (*Token, error) {
+	randomBytes := make([]byte, 12)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	expiredAt := time.Now().Add(ttl)
+
+	claims := SignedClaims{
+		UserID:    userID,
+		Scope:     scope,
+		Activated: activated,
+		ExpiredAt: expiredAt.Unix(),
+		ID:        base64.RawURLEncoding.EncodeToString(randomBytes),
+	}
+
+	js, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	signingInput := signedTokenPrefix + "." + s.activeKID + "." + base64.RawURLEncoding.EncodeToString(js)
+	signature := s.sign(s.keys[s.activeKID], signingInput)
+
+	token := &Token{
+		PlainText: signingInput + "." + base64.RawURLEncoding.EncodeToString(signature),
+		ExpiredAt: expiredAt,
+		UserID:    userID,
+		Scope:     scope,
+		Signed:    true,
+	}
+
+	hash := sha256.Sum256([]byte(token.PlainText))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+func (s *TokenSigner) Verify(tokenPlainText string) (*SignedClaims, error) {
+	parts := strings.Split(tokenPlainText, ".")
+	if len(parts) != 4 || parts[0] != signedTokenPrefix {
+		return nil, ErrInvalidSignedToken
+	}
+
+	key, ok := s.keys[parts[1]]
+	if !ok {
+		return nil, ErrInvalidSignedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+
+	expected := s.sign(key, strings.Join(parts[:3], "."))
+	if !hmac.Equal(signature, expected) {
+		return nil, ErrInvalidSignedToken
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+
+	var claims SignedClaims
+
+	err = json.Unmarshal(js, &claims)
+	if err != nil {
+		return nil, ErrInvalidSignedToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiredAt {
+		return nil, ErrInvalidSignedToken
+	}
+
+	return &claims, nil
+}
+
+func (s *TokenSigner) sign(key []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+
+	return mac.Sum(nil)
+}
+
+// RevocationList is an in-memory copy of the revoked_tokens table, which a
+// database trigger fills whenever an unexpired signed token is deleted.
+type RevocationList struct {
+	DB      *pgxpool.Pool
+	mu      sync.RWMutex
+	revoked map[[sha256.Size]byte]time.Time
+}
+
+func NewRevocationList(db *pgxpool.Pool) *RevocationList {
+	return &RevocationList{
+		DB:      db,
+		revoked: make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+func (l *RevocationList) IsRevoked(tokenPlainText string) bool {
+	hash := sha256.Sum256([]byte(tokenPlainText))
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.revoked[hash]
+	return ok
+}
+
+// Refresh reloads the list from the database, dropping expired entries.
+func (l *RevocationList) Refresh() error {
+	query := `
+		SELECT hash, expired_at FROM revoked_tokens
+		WHERE expired_at > $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := l.DB.Query(ctx, query, time.Now())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	revoked := make(map[[sha256.Size]byte]time.Time)
+
+	for rows.Next() {
+		var (
+			hash      []byte
+			expiredAt time.Time
+		)
+
+		err := rows.Scan(&hash, &expiredAt)
+		if err != nil {
+			return err
+		}
+
+		if len(hash) == sha256.Size {
+			revoked[[sha256.Size]byte(hash)] = expiredAt
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.revoked = revoked
+	l.mu.Unlock()
+
+	return nil
+}
+
+// DeleteExpired removes revocations for tokens that have expired anyway.
+func (l *RevocationList) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := l.DB.Exec(ctx, `DELETE FROM revoked_tokens WHERE expired_at <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenSignerVerify(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), 32)
+	newKey := bytes.Repeat([]byte("n"), 32)
+
+	mustSigner := func(keys map[string][]byte, activeKID string) *TokenSigner {
+		t.Helper()
+
+		signer, err := NewTokenSigner(keys, activeKID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signer
+	}
+
+	mustSign := func(signer *TokenSigner, ttl time.Duration) string {
+		t.Helper()
+
+		token, err := signer.Sign(42, true, ttl, ScopeAuthentication)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token.PlainText
+	}
+
+	oldSigner := mustSigner(map[string][]byte{"k1": oldKey}, "k1")
+	rotatedSigner := mustSigner(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	newOnlySigner := mustSigner(map[string][]byte{"k2": newKey}, "k2")
+
+	valid := mustSign(oldSigner, time.Hour)
+	parts := strings.Split(valid, ".")
+
+	// Swap one character of the signature for another base64url character
+	signature := []byte(parts[3])
+	if signature[0] == 'A' {
+		signature[0] = 'B'
+	} else {
+		signature[0] = 'A'
+	}
+	tamperedSignature := strings.Join([]string{parts[0], parts[1], parts[2], string(signature)}, ".")
+
+	// Claims of another token under this token's signature
+	otherClaims := strings.Split(mustSign(oldSigner, 2*time.Hour), ".")[2]
+	tamperedClaims := strings.Join([]string{parts[0], parts[1], otherClaims, parts[3]}, ".")
+
+	unknownKID := strings.Join([]string{parts[0], "k9", parts[2], parts[3]}, ".")
+
+	tests := []struct {
+		name   string
+		signer *TokenSigner
+		token  string
+		valid  bool
+	}{
+		{"valid", oldSigner, valid, true},
+		{"tampered signature", oldSigner, tamperedSignature, false},
+		{"tampered claims", oldSigner, tamperedClaims, false},
+		{"unknown key id", oldSigner, unknownKID, false},
+		{"key id missing from verifier", newOnlySigner, valid, false},
+		{"expired", oldSigner, mustSign(oldSigner, -time.Second), false},
+		{"signed before rotation", rotatedSigner, valid, true},
+		{"signed after rotation", rotatedSigner, mustSign(rotatedSigner, time.Hour), true},
+		{"signed after rotation, verified by old key set", oldSigner, mustSign(rotatedSigner, time.Hour), false},
+		{"signed after old key removed", newOnlySigner, mustSign(rotatedSigner, time.Hour), true},
+		{"malformed", oldSigner, "sb1.k1.abc", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.signer.Verify(tt.token)
+
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidSignedToken) {
+					t.Fatalf("got error %v, want ErrInvalidSignedToken", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if claims.UserID != 42 || claims.Scope != ScopeAuthentication || !claims.Activated {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ProfileStats are the counters shown on a profile. They are maintained by
+// triggers on follows, posts and likes rather than counted on read.
+type ProfileStats struct {
+	FollowersCount     int64 `json:"followers_count"`
+	FollowingCount     int64 `json:"following_count"`
+	PostsCount         int64 `json:"posts_count"`
+	LikesReceivedCount int64 `json:"likes_received_count"`
+}
+
+// Relationship describes how the viewer and a user are connected.
+type Relationship struct {
+	Following  bool `json:"following"`
+	FollowsYou bool `json:"follows_you"`
+}
+
+// GetStats returns userID's profile counters along with their relationship to
+// viewerID.
+func (m UserModel) GetStats(userID, viewerID int64) (*ProfileStats, *Relationship, error) {
+	query := `
+	SELECT
+		COALESCE(s.followers_count, 0),
+		COALESCE(s.following_count, 0),
+		COALESCE(s.posts_count, 0),
+		COALESCE(s.likes_received_count, 0),
+		EXISTS (SELECT 1 FROM follows WHERE user_id = u.id AND follower_id = $2),
+		EXISTS (SELECT 1 FROM follows WHERE user_id = $2 AND follower_id = u.id)
+	FROM users u
+	LEFT JOIN user_stats s ON s.user_id = u.id
+	WHERE u.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		stats        ProfileStats
+		relationship Relationship
+	)
+
+	err := m.DB.QueryRow(ctx, query, userID, viewerID).Scan(
+		&stats.FollowersCount,
+		&stats.FollowingCount,
+		&stats.PostsCount,
+		&stats.LikesReceivedCount,
+		&relationship.Following,
+		&relationship.FollowsYou,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrNoRecordFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return &stats, &relationship, nil
+}
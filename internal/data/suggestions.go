@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Each candidate source reads a bounded slice of the graph so suggestions
+// cost about the same for a user following five accounts as for one
+// following five thousand, or liking a post with a million likes. Only the
+// most recent edges of each followed account and liked post are read, so the
+// same graph always gives the same suggestions.
+const (
+	suggestionSourceFollows  = 200
+	suggestionSourceLikes    = 100
+	suggestionEdgesPerFollow = 25
+	suggestionEdgesPerLike   = 50
+	suggestionPopular        = 50
+)
+
+type Suggestion struct {
+	UserID    int64    `json:"user_id"`
+	Username  string   `json:"username"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	AvatarURL string   `json:"avatar_url"`
+	Reasons   []string `json:"reasons"`
+}
+
+// GetSuggestions ranks accounts userID might want to follow. Candidates are
+// followed by accounts userID follows, liked the same posts, or are popular.
+// Accounts already followed or requested, blocked in either direction, or
+// pending deletion are left out.
+//
+// Mutual follow and shared like counts, and so the counts in the reasons,
+// only cover the sampled edges. For well connected users they are lower
+// bounds rather than exact totals.
+func (m UserModel) GetSuggestions(userID int64, limit int) ([]*Suggestion, error) {
+	query := fmt.Sprintf(`
+	WITH my_follows AS (
+		SELECT user_id FROM follows
+		WHERE follower_id = $1
+		ORDER BY created_at DESC
+		LIMIT %[1]d
+	),
+	fof_edges AS (
+		SELECT e.user_id, e.follower_id, e.created_at FROM my_follows m
+		CROSS JOIN LATERAL (
+			SELECT f.user_id, f.follower_id, f.created_at FROM follows f
+			WHERE f.follower_id = m.user_id AND f.user_id <> $1
+			ORDER BY f.created_at DESC, f.user_id
+			LIMIT %[3]d
+		) e
+	),
+	fof AS (
+		SELECT user_id, count(*) AS mutual_count,
+		(array_agg(follower_id ORDER BY created_at DESC))[1] AS via_id
+		FROM fof_edges
+		GROUP BY user_id
+	),
+	my_likes AS (
+		SELECT post_id FROM likes
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT %[2]d
+	),
+	like_edges AS (
+		SELECT e.user_id FROM my_likes m
+		CROSS JOIN LATERAL (
+			SELECT l.user_id FROM likes l
+			WHERE l.post_id = m.post_id AND l.user_id <> $1
+			ORDER BY l.created_at DESC, l.user_id
+			LIMIT %[4]d
+		) e
+	),
+	co_likers AS (
+		SELECT user_id, count(*) AS shared_likes
+		FROM like_edges
+		GROUP BY user_id
+	),
+	popular AS (
+		SELECT user_id FROM user_stats
+		ORDER BY followers_count DESC
+		LIMIT %[5]d
+	),
+	candidates AS (
+		SELECT user_id FROM fof
+		UNION
+		SELECT user_id FROM co_likers
+		UNION
+		SELECT user_id FROM popular
+	)
+	SELECT u.id, u.username, u.first_name, u.last_name, u.avatar_url,
+	COALESCE(f.mutual_count, 0), COALESCE(via.username, ''),
+	COALESCE(cl.shared_likes, 0), COALESCE(s.followers_count, 0)
+	FROM candidates c
+	INNER JOIN users u ON u.id = c.user_id
+	LEFT JOIN fof f ON f.user_id = u.id
+	LEFT JOIN users via ON via.id = f.via_id
+	LEFT JOIN co_likers cl ON cl.user_id = u.id
+	LEFT JOIN user_stats s ON s.user_id = u.id
+	WHERE u.id <> $1
+	AND u.activated
+	AND u.deletion_requested_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM follows WHERE user_id = u.id AND follower_id = $1)
+	AND NOT EXISTS (SELECT 1 FROM follow_requests WHERE user_id = u.id AND requester_id = $1)
+	AND NOT EXISTS (
+		SELECT 1 FROM blocks b
+		WHERE (b.blocker_id = u.id AND b.blocked_id = $1)
+		OR (b.blocker_id = $1 AND b.blocked_id = u.id)
+	)
+	ORDER BY
+		3 * COALESCE(f.mutual_count, 0) + 2 * COALESCE(cl.shared_likes, 0) + ln(1 + COALESCE(s.followers_count, 0)) DESC,
+		u.id
+	LIMIT $2
+	`, suggestionSourceFollows, suggestionSourceLikes, suggestionEdgesPerFollow, suggestionEdgesPerLike, suggestionPopular)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+
+	for rows.Next() {
+		var (
+			suggestion     Suggestion
+			mutualCount    int64
+			viaUsername    string
+			sharedLikes    int64
+			followersCount int64
+		)
+
+		err := rows.Scan(
+			&suggestion.UserID,
+			&suggestion.Username,
+			&suggestion.FirstName,
+			&suggestion.LastName,
+			&suggestion.AvatarURL,
+			&mutualCount,
+			&viaUsername,
+			&sharedLikes,
+			&followersCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestion.Reasons = suggestionReasons(mutualCount, viaUsername, sharedLikes, followersCount)
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+func suggestionReasons(mutualCount int64, viaUsername string, sharedLikes, followersCount int64) []string {
+	reasons := []string{}
+
+	switch {
+	case mutualCount == 1:
+		reasons = append(reasons, fmt.Sprintf("followed by %s", viaUsername))
+	case mutualCount == 2:
+		reasons = append(reasons, fmt.Sprintf("followed by %s and 1 other", viaUsername))
+	case mutualCount > 2:
+		reasons = append(reasons, fmt.Sprintf("followed by %s and %d others", viaUsername, mutualCount-1))
+	}
+
+	switch {
+	case sharedLikes == 1:
+		reasons = append(reasons, "liked a post you liked")
+	case sharedLikes > 1:
+		reasons = append(reasons, fmt.Sprintf("liked %d posts you liked", sharedLikes))
+	}
+
+	if len(reasons) == 0 && followersCount > 0 {
+		reasons = append(reasons, "popular on Starbloom")
+	}
+
+	return reasons
+}
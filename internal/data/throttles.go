@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LockoutPolicy describes when repeated login failures lock a key out. Once
+// Threshold failures happen within Window, each further failure doubles the
+// lockout starting from BaseDelay, up to MaxDelay.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+type LoginThrottleModel struct {
+	DB *pgxpool.Pool
+}
+
+// LockedFor returns how much longer the most restricted of keys stays locked,
+// or zero if none of them are.
+func (m LoginThrottleModel) LockedFor(keys ...string) (time.Duration, error) {
+	query := `
+		SELECT COALESCE(MAX(locked_until), $2) FROM login_throttles
+		WHERE key = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	var lockedUntil time.Time
+
+	err := m.DB.QueryRow(ctx, query, keys, now).Scan(&lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	if !lockedUntil.After(now) {
+		return 0, nil
+	}
+
+	return lockedUntil.Sub(now), nil
+}
+
+// RecordFailure counts a failed attempt against key and returns the number of
+// failures in the current window along with any lockout it triggered. The
+// count and the lockout are updated in one statement, so concurrent failures
+// can't both slip under the threshold.
+func (m LoginThrottleModel) RecordFailure(key string, policy LockoutPolicy) (int, time.Duration, error) {
+	query := `
+		INSERT INTO login_throttles AS t (key, failures, last_failure_at, locked_until)
+		VALUES ($1, 1, $2, CASE WHEN $4 <= 1 THEN $2 + make_interval(secs => $5) END)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN t.last_failure_at < $3 THEN 1
+				ELSE t.failures + 1
+			END,
+			last_failure_at = $2,
+			locked_until = CASE
+				WHEN (CASE WHEN t.last_failure_at < $3 THEN 1 ELSE t.failures + 1 END) >= $4
+				THEN $2 + make_interval(secs => LEAST(
+					$5 * power(2, LEAST((CASE WHEN t.last_failure_at < $3 THEN 1 ELSE t.failures + 1 END) - $4, 30)),
+					$6
+				))
+				ELSE t.locked_until
+			END
+		RETURNING failures, locked_until
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	args := []any{
+		key,
+		now,
+		now.Add(-policy.Window),
+		policy.Threshold,
+		policy.BaseDelay.Seconds(),
+		policy.MaxDelay.Seconds(),
+	}
+
+	var (
+		failures    int
+		lockedUntil *time.Time
+	)
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&failures, &lockedUntil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if failures < policy.Threshold || lockedUntil == nil {
+		return failures, 0, nil
+	}
+
+	return failures, lockedUntil.Sub(now), nil
+}
+
+// Reset clears the failures and any lockout recorded against the keys.
+func (m LoginThrottleModel) Reset(keys ...string) error {
+	query := `
+		DELETE FROM login_throttles
+		WHERE key = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, keys)
+	return err
+}
+
+// DeleteStale removes unlocked keys whose last failure is older than before,
+// as their failure count would be reset by the next failure anyway.
+func (m LoginThrottleModel) DeleteStale(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM login_throttles
+		WHERE last_failure_at < $1
+		AND (locked_until IS NULL OR locked_until <= $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, before, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
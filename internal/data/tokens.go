@@ -7,23 +7,63 @@ import (
 	"database/sql"
 	"encoding/base32"
 	"errors"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kharljhon14/starbloom-server/internal/validator"
 )
 
+const personalAccessTokenPrefix = "sbp_"
+
 const (
+	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopeAuthorization  = "authorization"
+	ScopeEmailChange    = "email-change"
+	ScopeMFAPending     = "mfa-pending"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
 )
 
+var ErrTokenReuse = errors.New("refresh token reuse detected")
+
 type Token struct {
+	ID        int64     `json:"-"`
 	PlainText string    `json:"plain_text"`
 	Hash      []byte    `json:"-"`
 	ExpiredAt time.Time `json:"expired_at"`
 	UserID    int64     `json:"-"`
 	Scope     string    `json:"-"`
+	FamilyID  int64     `json:"-"`
+	Signed    bool      `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	UserAgent string    `json:"-"`
+	IP        string    `json:"-"`
+	// Name and Permissions are only set on personal access tokens.
+	Name        string      `json:"-"`
+	Permissions Permissions `json:"-"`
+}
+
+type PersonalAccessToken struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"created_at"`
+	LastUsedAt  time.Time   `json:"last_used_at"`
+	ExpiredAt   time.Time   `json:"expired_at"`
+}
+
+type Session struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiredAt  time.Time `json:"expired_at"`
+	Current    bool      `json:"current"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -56,8 +96,34 @@ func ValidateTokenPlainText(v *validator.Validator, tokenPlainText string) {
 	v.Check(len(tokenPlainText) == 26, "token", "must be 26 bytes long")
 }
 
+func IsPersonalAccessToken(tokenPlainText string) bool {
+	return strings.HasPrefix(tokenPlainText, personalAccessTokenPrefix)
+}
+
+func ValidatePersonalAccessToken(v *validator.Validator, tokenPlainText string) {
+	v.Check(IsPersonalAccessToken(tokenPlainText), "token", "must be a personal access token")
+	v.Check(len(tokenPlainText) == len(personalAccessTokenPrefix)+26, "token", "must be 30 bytes long")
+}
+
+func ValidatePersonalAccessTokenInput(v *validator.Validator, name string, permissions Permissions) {
+	v.Check(name != "", "name", "name is required")
+	v.Check(len(name) <= 100, "name", "name must not exceed 100 characters")
+
+	v.Check(len(permissions) > 0, "permissions", "at least one permission is required")
+
+	for i, permission := range permissions {
+		v.Check(GrantablePermissions.Include(permission), "permissions", "unknown permission "+permission)
+		v.Check(!slices.Contains(permissions[:i], permission), "permissions", "must not contain duplicate values")
+	}
+}
+
 type TokenModel struct {
 	DB *pgxpool.Pool
+	// Signer, when set, issues self-contained signed authentication tokens
+	// instead of opaque ones.
+	Signer *TokenSigner
+	// Cache, when set, is evicted of tokens as they are deleted.
+	Cache *AuthCache
 }
 
 func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -74,10 +140,318 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession creates an authentication token and the refresh token used to
+// renew it. Both belong to a new token family recording the device they were
+// issued to.
+func (m TokenModel) NewSession(
+	user *User,
+	accessTTL,
+	refreshTTL time.Duration,
+	userAgent,
+	ip string,
+) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var familyID int64
+	err = tx.QueryRow(ctx, `SELECT nextval('token_families_seq')`).Scan(&familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := m.insertTokenPair(ctx, tx, user.ID, user.Activated, familyID, accessTTL, refreshTTL, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new authentication and
+// refresh token in the same family. Presenting a refresh token that has
+// already been used revokes the whole family and returns ErrTokenReuse.
+func (m TokenModel) RotateRefreshToken(
+	tokenPlainText string,
+	accessTTL,
+	refreshTTL time.Duration,
+	userAgent,
+	ip string,
+) (*Token, *Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT t.id, t.user_id, t.family_id, t.expired_at, t.used_at, u.activated
+		FROM tokens t
+		INNER JOIN users u ON u.id = t.user_id
+		WHERE t.hash = $1 AND t.scope = $2
+		FOR UPDATE OF t
+	`
+
+	var (
+		token     Token
+		usedAt    *time.Time
+		activated bool
+	)
+
+	err = tx.QueryRow(ctx, query, tokenHash[:], ScopeRefresh).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.ExpiredAt,
+		&usedAt,
+		&activated,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrNoRecordFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec(ctx, `DELETE FROM tokens WHERE family_id = $1`, token.FamilyID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m.Cache.DeleteUser(token.UserID)
+
+		return nil, nil, ErrTokenReuse
+	}
+
+	if !token.ExpiredAt.After(time.Now()) {
+		return nil, nil, ErrNoRecordFound
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE tokens SET used_at = NOW() WHERE id = $1`, token.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`DELETE FROM tokens WHERE family_id = $1 AND scope = $2 RETURNING hash`,
+		token.FamilyID,
+		ScopeAuthentication,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replaced, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := m.insertTokenPair(ctx, tx, token.UserID, activated, token.FamilyID, accessTTL, refreshTTL, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, hash := range replaced {
+		if len(hash) == sha256.Size {
+			m.Cache.Delete([sha256.Size]byte(hash))
+		}
+	}
+
+	return access, refresh, nil
+}
+
+func (m TokenModel) insertTokenPair(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int64,
+	activated bool,
+	familyID int64,
+	accessTTL,
+	refreshTTL time.Duration,
+	userAgent,
+	ip string,
+) (*Token, *Token, error) {
+	var (
+		access *Token
+		err    error
+	)
+
+	if m.Signer != nil {
+		access, err = m.Signer.Sign(userID, activated, accessTTL, ScopeAuthentication)
+	} else {
+		access, err = generateToken(userID, accessTTL, ScopeAuthentication)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, token := range []*Token{access, refresh} {
+		token.FamilyID = familyID
+		token.UserAgent = userAgent
+		token.IP = ip
+
+		err = insertToken(ctx, tx, token)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, nil
+}
+
+// NewPersonalAccessToken creates a named, long-lived token limited to the
+// given permissions. Its plain text carries a prefix so the authenticate
+// middleware knows to look it up as one.
+func (m TokenModel) NewPersonalAccessToken(
+	userID int64,
+	ttl time.Duration,
+	name string,
+	permissions Permissions,
+) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthorization)
+	if err != nil {
+		return nil, err
+	}
+
+	token.PlainText = personalAccessTokenPrefix + token.PlainText
+	hash := sha256.Sum256([]byte(token.PlainText))
+	token.Hash = hash[:]
+
+	token.Name = name
+	token.Permissions = permissions
+
+	err = m.insert(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (m TokenModel) GetPersonalAccessTokens(userID int64) ([]*PersonalAccessToken, error) {
+	query := `
+		SELECT id, name, permissions, created_at, last_used_at, expired_at
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND expired_at > $3
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID, ScopeAuthorization, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*PersonalAccessToken{}
+
+	for rows.Next() {
+		var token PersonalAccessToken
+
+		err := rows.Scan(
+			&token.ID,
+			&token.Name,
+			&token.Permissions,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.ExpiredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (m TokenModel) DeletePersonalAccessToken(userID, tokenID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE id = $1 AND user_id = $2 AND scope = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, tokenID, userID, ScopeAuthorization)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	m.Cache.DeleteUser(userID)
+
+	return nil
+}
+
 func (m TokenModel) insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertToken(ctx, m.DB, token)
+}
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertToken(ctx context.Context, db rowQuerier, token *Token) error {
+	// The permissions column is NOT NULL, so store an empty array for tokens
+	// other than personal access tokens
+	permissions := token.Permissions
+	if permissions == nil {
+		permissions = Permissions{}
+	}
+
 	query := `
-	INSERT INTO tokens (hash, user_id, expired_at, scope)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO tokens (hash, user_id, expired_at, scope, family_id, user_agent, ip, signed, name, permissions)
+	VALUES ($1, $2, $3, $4, NULLIF($5::bigint, 0), $6, $7, $8, $9, $10)
+	RETURNING id, created_at
 	`
 
 	args := []interface{}{
@@ -85,17 +459,25 @@ func (m TokenModel) insert(token *Token) error {
 		token.UserID,
 		token.ExpiredAt,
 		token.Scope,
+		token.FamilyID,
+		token.UserAgent,
+		token.IP,
+		token.Signed,
+		token.Name,
+		permissions,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	_, err := m.DB.Exec(ctx, query, args...)
-
-	return err
+	return db.QueryRow(ctx, query, args...).Scan(&token.ID, &token.CreatedAt)
 }
 
 func (m TokenModel) GetForToken(tokenScope, tokenPlainText string) (*User, error) {
+	user, _, err := m.GetWithUser(tokenScope, tokenPlainText)
+	return user, err
+}
+
+// GetWithUser returns the unexpired token with the given scope along with
+// the user it belongs to.
+func (m TokenModel) GetWithUser(tokenScope, tokenPlainText string) (*User, *Token, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
 	query := `
@@ -107,7 +489,19 @@ func (m TokenModel) GetForToken(tokenScope, tokenPlainText string) (*User, error
 		u.last_name,
 		u.hashed_password,
 		u.created_at,
-		u.activated
+		u.activated,
+		u.bio,
+		u.website,
+		u.avatar_url,
+		u.is_private,
+		u.show_email,
+		u.show_bio,
+		u.show_website,
+		u.show_created_at,
+		u.version,
+		t.id,
+		t.expired_at,
+		t.permissions
 		FROM users u
 		INNER JOIN tokens t
 		ON u.id = t.user_id
@@ -127,6 +521,12 @@ func (m TokenModel) GetForToken(tokenScope, tokenPlainText string) (*User, error
 
 	var user User
 
+	token := Token{
+		PlainText: tokenPlainText,
+		Hash:      tokenHash[:],
+		Scope:     tokenScope,
+	}
+
 	err := m.DB.QueryRow(ctx, query, args...).Scan(
 		&user.ID,
 		&user.Username,
@@ -136,6 +536,75 @@ func (m TokenModel) GetForToken(tokenScope, tokenPlainText string) (*User, error
 		&user.Password.hash,
 		&user.CreatedAt,
 		&user.Activated,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
+		&token.ID,
+		&token.ExpiredAt,
+		&token.Permissions,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrNoRecordFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	token.UserID = user.ID
+
+	return &user, &token, nil
+}
+
+// ConsumeForToken deletes the unexpired token with the given scope and
+// returns the user it belonged to. Only one of any concurrent callers gets
+// the user, the rest see ErrNoRecordFound.
+func (m TokenModel) ConsumeForToken(tokenScope, tokenPlainText string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `
+		WITH consumed AS (
+			DELETE FROM tokens
+			WHERE hash = $1 AND scope = $2 AND expired_at > $3
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.email, u.first_name, u.last_name, u.hashed_password, u.created_at,
+		u.activated, u.bio, u.website, u.avatar_url, u.is_private, u.show_email, u.show_bio,
+		u.show_website, u.show_created_at, u.version
+		FROM users u
+		INNER JOIN consumed c ON c.user_id = u.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRow(ctx, query, tokenHash[:], tokenScope, time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.Activated,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -159,5 +628,262 @@ func (m TokenModel) DeleteAllForUser(scope string, userId int64) error {
 	defer cancel()
 
 	_, err := m.DB.Exec(ctx, query, scope, userId)
+	if err != nil {
+		return err
+	}
+
+	m.Cache.DeleteUser(userId)
+
+	return nil
+}
+
+func (m TokenModel) GetSessions(userID int64, currentTokenPlainText string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentTokenPlainText))
+
+	query := `
+		SELECT id, user_agent, ip, created_at, last_used_at, expired_at, hash = $2 AS current
+		FROM tokens
+		WHERE user_id = $1
+		AND scope = $3
+		AND expired_at > $4
+		ORDER BY last_used_at DESC
+	`
+
+	args := []any{
+		userID,
+		currentHash[:],
+		ScopeAuthentication,
+		time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiredAt,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes a session along with every other token in its family,
+// so its refresh token can't be used to start it again.
+func (m TokenModel) DeleteSession(userID, sessionID int64) error {
+	query := `
+	WITH target AS (
+		SELECT id, family_id FROM tokens
+		WHERE id = $1 AND user_id = $2 AND scope = $3
+	)
+	DELETE FROM tokens t
+	USING target
+	WHERE t.id = target.id OR t.family_id = target.family_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, sessionID, userID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	m.Cache.DeleteUser(userID)
+
+	return nil
+}
+
+// DeleteOtherSessions signs the user out of every session except the one
+// identified by currentTokenPlainText.
+func (m TokenModel) DeleteOtherSessions(userID int64, currentTokenPlainText string) error {
+	currentHash := sha256.Sum256([]byte(currentTokenPlainText))
+
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1
+	AND scope = ANY($2)
+	AND hash <> $3
+	AND (
+		family_id IS NULL OR
+		family_id IS DISTINCT FROM (SELECT family_id FROM tokens WHERE hash = $3)
+	)
+	`
+
+	args := []any{
+		userID,
+		[]string{ScopeAuthentication, ScopeRefresh},
+		currentHash[:],
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	m.Cache.DeleteUser(userID)
+
+	return nil
+}
+
+// DeleteForToken revokes a single token by its hash, along with any refresh
+// token in the same family so the session can't be renewed.
+func (m TokenModel) DeleteForToken(scope, tokenPlainText string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `
+	WITH target AS (
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2
+		RETURNING family_id
+	), family AS (
+		DELETE FROM tokens
+		WHERE family_id IN (SELECT family_id FROM target) AND hash <> $1
+	)
+	SELECT COUNT(*) FROM target
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deleted int
+	err := m.DB.QueryRow(ctx, query, tokenHash[:], scope).Scan(&deleted)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNoRecordFound
+	}
+
+	m.Cache.Delete(tokenHash)
+
+	return nil
+}
+
+// DeleteAllSessionsForUser revokes every authentication and refresh token
+// belonging to the user.
+func (m TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, userID, []string{ScopeAuthentication, ScopeRefresh})
+	if err != nil {
+		return err
+	}
+
+	m.Cache.DeleteUser(userID)
+
+	return nil
+}
+
+// DeleteEverythingForUser removes every token the user holds, whatever its
+// scope, including personal access tokens.
+func (m TokenModel) DeleteEverythingForUser(userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	m.Cache.DeleteUser(userID)
+
+	return nil
+}
+
+// TouchSessions records when each token hash was last used in a single
+// statement. Timestamps never move backwards.
+func (m TokenModel) TouchSessions(lastUsed map[[sha256.Size]byte]time.Time) error {
+	if len(lastUsed) == 0 {
+		return nil
+	}
+
+	hashes := make([][]byte, 0, len(lastUsed))
+	times := make([]time.Time, 0, len(lastUsed))
+
+	for hash, usedAt := range lastUsed {
+		hashes = append(hashes, hash[:])
+		times = append(times, usedAt)
+	}
+
+	query := `
+	UPDATE tokens t
+	SET last_used_at = v.last_used_at
+	FROM unnest($1::bytea[], $2::timestamptz[]) AS v(hash, last_used_at)
+	WHERE t.hash = v.hash AND t.last_used_at < v.last_used_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, query, hashes, times)
 	return err
 }
+
+// DeleteExpired removes up to limit expired tokens of every scope and returns
+// how many were deleted. Callers wanting a full purge repeat it until fewer
+// than limit rows come back, which keeps each statement's locks short.
+func (m TokenModel) DeleteExpired(limit int) (int64, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE id IN (
+		SELECT id FROM tokens
+		WHERE expired_at <= $1
+		LIMIT $2
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
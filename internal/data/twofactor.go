@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+	ErrCodeReused       = errors.New("code already used")
+)
+
+type TwoFactor struct {
+	UserID   int64
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type TwoFactorModel struct {
+	DB *pgxpool.Pool
+}
+
+// Get returns the user's TOTP settings, or ErrNoRecordFound when the user has
+// never started enrollment.
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT id, totp_secret, totp_enabled, totp_last_step
+		FROM users
+		WHERE id = $1 AND totp_secret IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var twoFactor TwoFactor
+
+	err := m.DB.QueryRow(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.Secret,
+		&twoFactor.Enabled,
+		&twoFactor.LastStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &twoFactor, nil
+}
+
+// SetPendingSecret stores a new secret awaiting confirmation, replacing any
+// earlier unconfirmed one.
+func (m TwoFactorModel) SetPendingSecret(userID int64, secret string) error {
+	query := `
+		UPDATE users SET totp_secret = $1, totp_last_step = 0
+		WHERE id = $2 AND NOT totp_enabled
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// Enable turns on two-factor authentication and returns a fresh set of
+// plain text recovery codes. Only their hashes are stored.
+func (m TwoFactorModel) Enable(userID, step int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(
+		ctx,
+		`UPDATE users SET totp_enabled = true, totp_last_step = $1 WHERE id = $2 AND NOT totp_enabled`,
+		step,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.RowsAffected() == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`,
+			userID,
+			hashRecoveryCode(code),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (m TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0 WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseStep records that the code for step has been used, returning
+// ErrCodeReused if that step or a later one was already accepted.
+func (m TwoFactorModel) UseStep(userID, step int64) error {
+	query := `
+		UPDATE users SET totp_last_step = $1
+		WHERE id = $2 AND totp_last_step < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrCodeReused
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes one of the user's unused recovery codes.
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) error {
+	query := `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+func generateRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 10)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes))
+
+	return code[:8] + "-" + code[8:], nil
+}
+
+// hashRecoveryCode normalises the code so users can type it without the
+// dash or in upper case. Codes carry 80 bits of entropy, so a fast hash is
+// enough.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(code))
+
+	return hash[:]
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUseStepRejectsReuse(t *testing.T) {
+	db := testDB(t)
+	users := UserModel{DB: db}
+	m := TwoFactorModel{DB: db}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	user := &User{
+		Username:  "step_" + suffix,
+		Email:     "step_" + suffix + "@example.com",
+		FirstName: "Step",
+		LastName:  "Reuse",
+	}
+
+	err := user.Password.Set("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := time.Now().Unix() / 30
+
+	tests := []struct {
+		name string
+		step int64
+		err  error
+	}{
+		{"first use", step, nil},
+		{"same step", step, ErrCodeReused},
+		{"earlier step", step - 1, ErrCodeReused},
+		{"later step", step + 1, nil},
+		{"step before the later one", step, ErrCodeReused},
+	}
+
+	for _, tt := range tests {
+		err := m.UseStep(user.ID, tt.step)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
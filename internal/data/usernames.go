@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrUsernameChangeTooSoon = errors.New("username changed too recently")
+
+// Rename changes a user's username. The old username is recorded in the
+// username history and held for the user until hold has passed, so links to
+// it keep resolving and nobody else can claim it in the meantime. Users may
+// only rename once per cooldown.
+func (m UserModel) Rename(user *User, username string, cooldown, hold time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The current username is only retired if the version still matches,
+	// in which case it is the one the caller read
+	err = lockUsernames(ctx, tx, user.Username, username)
+	if err != nil {
+		return err
+	}
+
+	var (
+		current   string
+		changedAt *time.Time
+	)
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT username, username_changed_at FROM users WHERE id = $1 AND version = $2 FOR UPDATE`,
+		user.ID,
+		user.Version,
+	).Scan(&current, &changedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if changedAt != nil && time.Since(*changedAt) < cooldown {
+		return ErrUsernameChangeTooSoon
+	}
+
+	var held bool
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM username_history
+			WHERE username = $1 AND user_id <> $2 AND held_until > NOW()
+		)`,
+		username,
+		user.ID,
+	).Scan(&held)
+	if err != nil {
+		return err
+	}
+
+	if held {
+		return ErrDuplicateUsername
+	}
+
+	// Taking back one of their own old usernames releases its hold
+	_, err = tx.Exec(ctx, `DELETE FROM username_history WHERE user_id = $1 AND username = $2`, user.ID, username)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO username_history (user_id, username, held_until) VALUES ($1, $2, $3)`,
+		user.ID,
+		current,
+		time.Now().Add(hold),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`UPDATE users SET username = $1, username_changed_at = NOW(), version = version + 1
+		WHERE id = $2
+		RETURNING version`,
+		username,
+		user.ID,
+	).Scan(&user.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "users_username_key":
+			return ErrDuplicateUsername
+		default:
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	user.Username = username
+
+	return nil
+}
+
+// lockUsernames takes a transaction scoped lock on each username, in a fixed
+// order so two renames can't deadlock. Anything that claims or retires a
+// username holds its lock, so a hold check can't miss a hold that another
+// transaction is about to commit.
+func lockUsernames(ctx context.Context, tx pgx.Tx, usernames ...string) error {
+	usernames = slices.Clone(usernames)
+	slices.Sort(usernames)
+
+	for _, username := range slices.Compact(usernames) {
+		_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "username:"+username)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByRetiredUsername finds the user who most recently gave up username, as
+// long as it is still held for them.
+func (m UserModel) GetByRetiredUsername(username string) (*User, error) {
+	query := `
+	SELECT u.id, u.username, u.email, u.hashed_password, u.first_name, u.last_name, u.activated, u.created_at,
+	u.bio, u.website, u.avatar_url, u.is_private, u.show_email, u.show_bio, u.show_website, u.show_created_at, u.version
+	FROM username_history h
+	INNER JOIN users u ON u.id = h.user_id
+	WHERE h.username = $1 AND h.held_until > NOW()
+	ORDER BY h.retired_at DESC
+	LIMIT 1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.FirstName,
+		&user.LastName,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// DeleteExpiredUsernameHolds removes up to limit history entries whose hold
+// has passed. They no longer resolve or block anyone from the username.
+func (m UserModel) DeleteExpiredUsernameHolds(limit int) (int64, error) {
+	query := `
+	DELETE FROM username_history
+	WHERE id IN (
+		SELECT id FROM username_history
+		WHERE held_until <= $1
+		LIMIT $2
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
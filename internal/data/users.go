@@ -4,12 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kharljhon14/starbloom-server/internal/validator"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -25,15 +28,25 @@ type UserModel struct {
 
 var AnonymousUser = &User{}
 
+// User is never encoded directly. Its MarshalJSON renders the public profile,
+// so fields added here stay private until a projection exposes them. See
+// PublicProfile and SelfProfile.
 type User struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Activated bool      `json:"activated"`
-	Password  password  `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int64
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	Bio       string
+	Website   string
+	AvatarURL string
+	IsPrivate bool
+	Privacy   PrivacySettings
+	Activated bool
+	IsAdmin   bool
+	Password  password
+	CreatedAt time.Time
+	Version   int
 }
 
 type password struct {
@@ -41,11 +54,35 @@ type password struct {
 	hash      []byte
 }
 
+// Insert creates a user. Usernames another user retired recently are still
+// held for them and reported as ErrDuplicateUsername.
 func (m UserModel) Insert(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// insertUser creates a user in tx, holding the username's lock until tx ends.
+func insertUser(ctx context.Context, tx pgx.Tx, user *User) error {
 	query := `
-	INSERT INTO users (username, email, first_name, last_name, hashed_password)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id, created_at
+	INSERT INTO users (username, email, first_name, last_name, hashed_password, activated)
+	SELECT $1, $2, $3, $4, $5, $6
+	WHERE NOT EXISTS (
+		SELECT 1 FROM username_history WHERE username = $1 AND held_until > NOW()
+	)
+	RETURNING id, created_at, show_email, show_bio, show_website, show_created_at, version
 	`
 
 	args := []interface{}{
@@ -54,15 +91,30 @@ func (m UserModel) Insert(user *User) error {
 		user.FirstName,
 		user.LastName,
 		user.Password.hash,
+		user.Activated,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	err := lockUsernames(ctx, tx, user.Username)
+	if err != nil {
+		return err
+	}
 
-	err := m.DB.QueryRow(ctx, query, args...).Scan(&user.ID, &user.CreatedAt)
+	err = tx.QueryRow(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
+	)
 	if err != nil {
 		var pgErr *pgconn.PgError
 
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateUsername
+		}
+
 		if errors.As(err, &pgErr) {
 			switch pgErr.ConstraintName {
 			case "users_username_key":
@@ -79,7 +131,8 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetUser(username string) (*User, error) {
 	query := `
-	SELECT id, username, email, hashed_password, first_name, last_name, created_at
+	SELECT id, username, email, hashed_password, first_name, last_name, activated, created_at,
+	bio, website, avatar_url, is_private, show_email, show_bio, show_website, show_created_at, version
 	FROM users
 	WHERE username = $1
 	`
@@ -96,7 +149,17 @@ func (m UserModel) GetUser(username string) (*User, error) {
 		&user.Password.hash,
 		&user.FirstName,
 		&user.LastName,
+		&user.Activated,
 		&user.CreatedAt,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
 	)
 	if err != nil {
 		switch {
@@ -110,30 +173,396 @@ func (m UserModel) GetUser(username string) (*User, error) {
 	return &user, nil
 }
 
-func (p *password) Set(plainTextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), 12)
+func (m UserModel) GetByID(id int64) (*User, error) {
+	query := `
+	SELECT id, username, email, hashed_password, first_name, last_name, activated, is_admin, created_at,
+	bio, website, avatar_url, is_private, show_email, show_bio, show_website, show_created_at, version
+	FROM users
+	WHERE id = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, id).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.FirstName,
+		&user.LastName,
+		&user.Activated,
+		&user.IsAdmin,
+		&user.CreatedAt,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) GetByEmail(email string) (*User, error) {
+	query := `
+	SELECT id, username, email, hashed_password, first_name, last_name, activated, created_at,
+	bio, website, avatar_url, is_private, show_email, show_bio, show_website, show_created_at, version
+	FROM users
+	WHERE email = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.FirstName,
+		&user.LastName,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.Bio,
+		&user.Website,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.Privacy.ShowEmail,
+		&user.Privacy.ShowBio,
+		&user.Privacy.ShowWebsite,
+		&user.Privacy.ShowCreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// Update saves the user, failing with ErrEditConflict if it was changed since
+// it was read.
+func (m UserModel) Update(user *User) error {
+	query := `
+	UPDATE users
+	SET username = $1, email = $2, first_name = $3, last_name = $4, hashed_password = $5, activated = $6,
+	bio = $7, website = $8, avatar_url = $9, is_private = $10,
+	show_email = $11, show_bio = $12, show_website = $13, show_created_at = $14, version = version + 1
+	WHERE id = $15 AND version = $16
+	RETURNING version
+	`
+
+	args := []any{
+		user.Username,
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		user.Password.hash,
+		user.Activated,
+		user.Bio,
+		user.Website,
+		user.AvatarURL,
+		user.IsPrivate,
+		user.Privacy.ShowEmail,
+		user.Privacy.ShowBio,
+		user.Privacy.ShowWebsite,
+		user.Privacy.ShowCreatedAt,
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "users_username_key":
+			return ErrDuplicateUsername
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "users_email_key":
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CanView reports whether viewerID may see content owned by ownerID. Content
+// of private accounts is only visible to the owner and approved followers.
+// Owners who have blocked the viewer are reported as ErrNoRecordFound.
+func (m UserModel) CanView(ownerID, viewerID int64) (bool, error) {
+	query := `
+	SELECT NOT u.is_private OR u.id = $2 OR EXISTS (
+		SELECT 1 FROM follows WHERE user_id = u.id AND follower_id = $2
+	)
+	FROM users u
+	WHERE u.id = $1 AND u.deletion_requested_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE blocker_id = u.id AND blocked_id = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var visible bool
+
+	err := m.DB.QueryRow(ctx, query, ownerID, viewerID).Scan(&visible)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrNoRecordFound
+		default:
+			return false, err
+		}
+	}
+
+	return visible, nil
+}
+
+// SetPendingEmail records the address a user is changing to until they
+// confirm it with ConfirmPendingEmail.
+func (m UserModel) SetPendingEmail(userID int64, email string) error {
+	query := `
+	UPDATE users
+	SET pending_email = $1, version = version + 1
+	WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, email, userID)
 	if err != nil {
 		return err
 	}
 
-	p.plainText = &plainTextPassword
-	p.hash = hash
+	if res.RowsAffected() == 0 {
+		return ErrNoRecordFound
+	}
 
 	return nil
 }
 
-func (p *password) Matches(plainTextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plainTextPassword))
+// ConfirmPendingEmail swaps the user's email for their pending one, updating
+// user with the new address and version.
+func (m UserModel) ConfirmPendingEmail(user *User) error {
+	query := `
+	UPDATE users
+	SET email = pending_email, pending_email = NULL, version = version + 1
+	WHERE id = $1 AND pending_email IS NOT NULL
+	RETURNING email, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, user.ID).Scan(&user.Email, &user.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNoRecordFound
+		case errors.As(err, &pgErr) && pgErr.ConstraintName == "users_email_key":
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ScheduleDeletion marks the account as pending deletion and returns when
+// that started. Content of accounts pending deletion is hidden until they are
+// purged by PurgeDeleted or the deletion is cancelled.
+func (m UserModel) ScheduleDeletion(userID int64) (time.Time, error) {
+	query := `
+	UPDATE users
+	SET deletion_requested_at = COALESCE(deletion_requested_at, NOW()), version = version + 1
+	WHERE id = $1
+	RETURNING deletion_requested_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var requestedAt time.Time
+
+	err := m.DB.QueryRow(ctx, query, userID).Scan(&requestedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrNoRecordFound
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return requestedAt, nil
+}
+
+// CancelDeletion clears a pending deletion, reporting whether there was one.
+func (m UserModel) CancelDeletion(userID int64) (bool, error) {
+	query := `
+	UPDATE users
+	SET deletion_requested_at = NULL
+	WHERE id = $1 AND deletion_requested_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.Exec(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return res.RowsAffected() > 0, nil
+}
+
+// PurgeDeleted permanently removes up to limit accounts whose deletion was
+// requested before the given time, along with everything they created. Each
+// account is removed in its own transaction.
+func (m UserModel) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	query := `
+	SELECT id FROM users
+	WHERE deletion_requested_at <= $1
+	ORDER BY deletion_requested_at
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+
+	for _, id := range ids {
+		ok, err := m.purge(id, before)
+		if err != nil {
+			return purged, err
+		}
+
+		if ok {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// purge deletes a single account unless its deletion was cancelled since it
+// was selected.
+func (m UserModel) purge(userID int64, before time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT id FROM users WHERE id = $1 AND deletion_requested_at <= $2 FOR UPDATE`,
+		userID,
+		before,
+	).Scan(&id)
 	if err != nil {
 		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		case errors.Is(err, sql.ErrNoRows):
 			return false, nil
 		default:
 			return false, err
 		}
 	}
 
-	return true, nil
+	queries := []string{
+		`DELETE FROM likes WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+		`DELETE FROM comments WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+		`DELETE FROM posts WHERE user_id = $1`,
+		`DELETE FROM follows WHERE user_id = $1 OR follower_id = $1`,
+		`DELETE FROM tokens WHERE user_id = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	}
+
+	for _, query := range queries {
+		_, err = tx.Exec(ctx, query, userID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func (p *password) Set(plainTextPassword string) error {
+	hash, err := passwordHashing.current.Hash(plainTextPassword)
+	if err != nil {
+		return err
+	}
+
+	p.plainText = &plainTextPassword
+	p.hash = hash
+
+	return nil
+}
+
+// Matches checks plainTextPassword against the stored hash. The second result
+// reports whether the hash was made with another algorithm or parameters than
+// the current hasher, in which case the caller should Set the password again.
+func (p *password) Matches(plainTextPassword string) (bool, bool, error) {
+	hasher, err := hasherFor(p.hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	match, outdated, err := hasher.Verify(p.hash, plainTextPassword)
+	if err != nil || !match {
+		return false, false, err
+	}
+
+	return true, outdated || hasher != passwordHashing.current, nil
 }
 
 func (u *User) IsAnonymous() bool {
@@ -141,27 +570,166 @@ func (u *User) IsAnonymous() bool {
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.Username != "", "username", "username is required")
-	v.Check(len(user.Username) >= 5, "username", "username must be atleast 5 characters")
-	v.Check(len(user.Username) <= 60, "username", "username must not exceed 60 characters")
+	ValidateUsername(v, user.Username)
+	ValidateEmail(v, user.Email)
+	ValidateProfile(v, user)
 
-	v.Check(user.Email != "", "email", "email is required")
-	v.Check(len(user.Email) <= 255, "email", "email must not exceed 255 characters")
-	v.Check(validator.Matches(user.Email, validator.EmailRX), "email", "must be a valid email")
+	if user.Password.plainText != nil {
+		ValidatePlainTextPassword(v, *user.Password.plainText)
+	}
+}
 
+func ValidateUsername(v *validator.Validator, username string) {
+	v.Check(username != "", "username", "username is required")
+	v.Check(len(username) >= 5, "username", "username must be atleast 5 characters")
+	v.Check(len(username) <= 60, "username", "username must not exceed 60 characters")
+}
+
+// ValidateProfile checks the optional profile fields users edit themselves.
+func ValidateProfile(v *validator.Validator, user *User) {
 	v.Check(user.FirstName != "", "first_name", "first name is required")
 	v.Check(len(user.FirstName) <= 255, "first_name", "first name must not execeed 255 characters")
 
 	v.Check(user.LastName != "", "last_name", "last name is required")
 	v.Check(len(user.LastName) <= 255, "last_name", "last name must not execeed 255 characters")
 
-	if user.Password.plainText != nil {
-		ValidatePlainTextPassword(v, *user.Password.plainText)
+	v.Check(utf8.RuneCountInString(user.Bio) <= 500, "bio", "bio must not exceed 500 characters")
+
+	if user.Website != "" {
+		v.Check(len(user.Website) <= 255, "website", "website must not exceed 255 characters")
+		v.Check(validator.IsWebURL(user.Website), "website", "must be a valid http or https URL")
 	}
+
+	if user.AvatarURL != "" {
+		v.Check(len(user.AvatarURL) <= 2048, "avatar_url", "avatar URL must not exceed 2048 characters")
+		v.Check(strings.HasPrefix(user.AvatarURL, "https://") && validator.IsWebURL(user.AvatarURL), "avatar_url", "must be a valid https URL")
+	}
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "email is required")
+	v.Check(len(email) <= 255, "email", "email must not exceed 255 characters")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email")
 }
 
 func ValidatePlainTextPassword(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "password is required")
 	v.Check(len(password) >= 8, "password", "password must be atleast 8 characters")
-	v.Check(len(password) <= 60, "password", "password must not exceed 60 characters")
+
+	maxLength := passwordHashing.current.MaxLength()
+	v.Check(len(password) <= maxLength, "password", fmt.Sprintf("password must not exceed %d characters", maxLength))
 }
+
+type UserSearchResult struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	AvatarURL string `json:"avatar_url"`
+	Followed  bool   `json:"followed"`
+}
+
+// searchBranchLimit caps how many candidates each way of matching a search
+// contributes, so a short, common query costs about the same as a rare one.
+const searchBranchLimit = 500
+
+// Search finds users whose username or full name starts with or resembles
+// query. Exact username matches come first, then users the viewer follows,
+// then prefix matches, then the rest by trigram similarity.
+//
+// Each kind of match is its own index backed subquery, capped at
+// searchBranchLimit, and only their union is ranked, so the total in the
+// metadata is a lower bound once a branch reaches the cap.
+func (m UserModel) Search(query string, viewerID int64, filters Filter) ([]*UserSearchResult, Metadata, error) {
+	stmt := fmt.Sprintf(`
+		WITH candidates AS (
+			SELECT id FROM users WHERE lower(username) = $1
+			UNION
+			(SELECT f.user_id FROM follows f
+			INNER JOIN users u ON u.id = f.user_id
+			WHERE f.follower_id = $2
+			AND (lower(u.username) LIKE $3 OR lower(u.first_name || ' ' || u.last_name) LIKE $3)
+			LIMIT %[1]d)
+			UNION
+			(SELECT id FROM users WHERE lower(username) LIKE $3 LIMIT %[1]d)
+			UNION
+			(SELECT id FROM users WHERE lower(first_name || ' ' || last_name) LIKE $3 LIMIT %[1]d)
+			UNION
+			(SELECT id FROM users WHERE lower(username) %% $1 LIMIT %[1]d)
+			UNION
+			(SELECT id FROM users WHERE lower(first_name || ' ' || last_name) %% $1 LIMIT %[1]d)
+		),
+		matches AS (
+			SELECT u.id, u.username, u.first_name, u.last_name, u.avatar_url,
+			f.follower_id IS NOT NULL AS followed
+			FROM candidates c
+			INNER JOIN users u ON u.id = c.id
+			LEFT JOIN follows f ON f.user_id = u.id AND f.follower_id = $2
+			WHERE u.deletion_requested_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = $2)
+				OR (b.blocker_id = $2 AND b.blocked_id = u.id)
+			)
+		)
+		SELECT (SELECT count(*) FROM matches), id, username, first_name, last_name, avatar_url, followed
+		FROM matches
+		ORDER BY
+			lower(username) = $1 DESC,
+			followed DESC,
+			lower(username) LIKE $3 DESC,
+			GREATEST(
+				similarity(lower(username), $1),
+				similarity(lower(first_name || ' ' || last_name), $1)
+			) DESC,
+			id
+		LIMIT $4 OFFSET $5
+	`, searchBranchLimit)
+
+	query = strings.ToLower(query)
+	prefix := likeEscaper.Replace(query) + "%"
+
+	args := []any{query, viewerID, prefix, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*UserSearchResult{}
+
+	for rows.Next() {
+		var user UserSearchResult
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.Username,
+			&user.FirstName,
+			&user.LastName,
+			&user.AvatarURL,
+			&user.Followed,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/kharljhon14/starbloom-server/internal/jsonlog"
+)
+
+// Task is a unit of periodic background work.
+type Task struct {
+	Name     string
+	Interval time.Duration
+	// Jitter is the most each run is moved earlier or later at random, so
+	// instances started together don't all hit the database at once.
+	Jitter time.Duration
+	// Quiet tasks run too often to log every success and only log failures.
+	Quiet bool
+	// Run does the work. The returned properties are added to the log line,
+	// and ctx is cancelled when the runner stops.
+	Run func(ctx context.Context) (map[string]string, error)
+}
+
+// Runner runs each of its tasks on its own schedule until stopped.
+type Runner struct {
+	logger *jsonlog.Logger
+	tasks  []Task
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(logger *jsonlog.Logger, tasks ...Task) *Runner {
+	return &Runner{
+		logger: logger,
+		tasks:  tasks,
+	}
+}
+
+func (r *Runner) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	for _, task := range r.tasks {
+		r.wg.Add(1)
+
+		go func() {
+			defer r.wg.Done()
+			r.schedule(ctx, task)
+		}()
+	}
+
+	r.logger.PrintInfo("started background jobs", map[string]string{
+		"tasks": fmt.Sprint(len(r.tasks)),
+	})
+}
+
+// Stop cancels running tasks and waits for them to return.
+func (r *Runner) Stop() {
+	if r.cancel == nil {
+		return
+	}
+
+	r.cancel()
+	r.wg.Wait()
+
+	r.logger.PrintInfo("stopped background jobs", nil)
+}
+
+func (r *Runner) schedule(ctx context.Context, task Task) {
+	// The first run is spread over the jitter alone rather than waiting a
+	// whole interval, so long-period tasks still run soon after startup
+	timer := time.NewTimer(randomDuration(task.Jitter))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			r.run(ctx, task)
+
+			delay := task.Interval + randomDuration(2*task.Jitter) - task.Jitter
+			timer.Reset(max(delay, time.Second))
+		}
+	}
+}
+
+func (r *Runner) run(ctx context.Context, task Task) {
+	start := time.Now()
+
+	defer func() {
+		if err := recover(); err != nil {
+			r.logger.PrintError(fmt.Sprintf("%s", err), map[string]string{
+				"task": task.Name,
+			})
+		}
+	}()
+
+	properties, err := task.Run(ctx)
+
+	logProperties := map[string]string{
+		"task":     task.Name,
+		"duration": time.Since(start).String(),
+	}
+	maps.Copy(logProperties, properties)
+
+	if err != nil {
+		r.logger.PrintError(err.Error(), logProperties)
+		return
+	}
+
+	if !task.Quiet {
+		r.logger.PrintInfo("background job finished", logProperties)
+	}
+}
+
+func randomDuration(n time.Duration) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+
+	return rand.N(n)
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	textTemplate "text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends a templated email to a single recipient. The template file
+// must define "subject", "plainBody" and "htmlBody" blocks.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+func render(sender, recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := textTemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The HTML body is parsed separately so that values are escaped
+	htmlTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:      sender,
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// WriterMailer renders emails to an io.Writer instead of delivering them,
+// which lets development and test environments run without a mail server.
+type WriterMailer struct {
+	out    io.Writer
+	sender string
+	mu     sync.Mutex
+}
+
+func NewWriter(out io.Writer, sender string) *WriterMailer {
+	return &WriterMailer{
+		out:    out,
+		sender: sender,
+	}
+}
+
+func (m *WriterMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(
+		m.out,
+		"From: %s\nTo: %s\nSubject: %s\n\n%s\n\n%s\n-----\n",
+		msg.From,
+		msg.To,
+		msg.Subject,
+		msg.PlainBody,
+		msg.HTMLBody,
+	)
+
+	return err
+}
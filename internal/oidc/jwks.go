@@ -0,0 +1,136 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+var errUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type publicKey struct {
+	kid string
+	rsa *rsa.PublicKey
+	ec  *ecdsa.PublicKey
+}
+
+type keySet []*publicKey
+
+// parse keeps the RSA and P-256 signing keys, skipping anything it can't use.
+func (s jsonWebKeySet) parse() keySet {
+	keys := keySet{}
+
+	for _, jwk := range s.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch jwk.Kty {
+		case "RSA":
+			n, err := decodeBigInt(jwk.N)
+			if err != nil {
+				continue
+			}
+
+			e, err := decodeBigInt(jwk.E)
+			if err != nil || !e.IsInt64() {
+				continue
+			}
+
+			keys = append(keys, &publicKey{
+				kid: jwk.Kid,
+				rsa: &rsa.PublicKey{N: n, E: int(e.Int64())},
+			})
+		case "EC":
+			if jwk.Crv != "P-256" {
+				continue
+			}
+
+			x, err := decodeBigInt(jwk.X)
+			if err != nil {
+				continue
+			}
+
+			y, err := decodeBigInt(jwk.Y)
+			if err != nil {
+				continue
+			}
+
+			keys = append(keys, &publicKey{
+				kid: jwk.Kid,
+				ec:  &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+			})
+		}
+	}
+
+	return keys
+}
+
+// find returns the key with the given ID. Tokens without a key ID are only
+// matched when the set holds a single key.
+func (s keySet) find(kid string) *publicKey {
+	if kid == "" && len(s) == 1 {
+		return s[0]
+	}
+
+	for _, key := range s {
+		if key.kid == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (k *publicKey) verify(alg string, signingInput, signature []byte) error {
+	hash := sha256.Sum256(signingInput)
+
+	switch {
+	case alg == "RS256" && k.rsa != nil:
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, hash[:], signature)
+	case alg == "ES256" && k.ec != nil:
+		if len(signature) != 64 {
+			return errUnsupportedAlgorithm
+		}
+
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+
+		if !ecdsa.Verify(k.ec, hash[:], r, s) {
+			return errors.New("invalid signature")
+		}
+
+		return nil
+	default:
+		return errUnsupportedAlgorithm
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,492 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testClientID = "starbloom-test"
+
+// testIssuer is a local stand-in for an OpenID Connect provider. It serves
+// discovery, a JWKS and a token endpoint that checks the PKCE verifier.
+type testIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	jwksHits  atomic.Int64
+	jwksGate  chan struct{}
+	mu        sync.Mutex
+	published []jsonWebKey
+	codes     map[string]issuedCode
+}
+
+type issuedCode struct {
+	challenge string
+	idToken   string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &testIssuer{
+		t:      t,
+		rsaKey: rsaKey,
+		ecKey:  ecKey,
+		codes:  make(map[string]issuedCode),
+	}
+
+	issuer.publish(rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discoveryHandler)
+	mux.HandleFunc("GET /jwks", issuer.jwksHandler)
+	mux.HandleFunc("POST /token", issuer.tokenHandler)
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (i *testIssuer) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:        "test",
+		Issuer:      i.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://starbloom.test/callback",
+	})
+}
+
+func (i *testIssuer) publish(keys ...jsonWebKey) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.published = keys
+}
+
+func (i *testIssuer) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeTestJSON(w, map[string]string{
+		"issuer":                 i.server.URL,
+		"authorization_endpoint": i.server.URL + "/authorize",
+		"token_endpoint":         i.server.URL + "/token",
+		"jwks_uri":               i.server.URL + "/jwks",
+	})
+}
+
+func (i *testIssuer) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	i.jwksHits.Add(1)
+
+	if i.jwksGate != nil {
+		<-i.jwksGate
+	}
+
+	i.mu.Lock()
+	keys := i.published
+	i.mu.Unlock()
+
+	writeTestJSON(w, jsonWebKeySet{Keys: keys})
+}
+
+func (i *testIssuer) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	code, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != testClientID,
+		!ok,
+		CodeChallenge(r.PostForm.Get("code_verifier")) != code.challenge:
+		w.WriteHeader(http.StatusBadRequest)
+		writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeTestJSON(w, map[string]string{"id_token": code.idToken, "token_type": "Bearer"})
+}
+
+// authorize stands in for the user signing in at the provider, returning
+// the code it would redirect back with.
+func (i *testIssuer) authorize(authURL string, claims map[string]any) string {
+	i.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	qs := u.Query()
+
+	if qs.Get("code_challenge_method") != "S256" || qs.Get("client_id") != testClientID {
+		i.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	claims["nonce"] = qs.Get("nonce")
+
+	code, err := RandomString(16)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	i.mu.Lock()
+	i.codes[code] = issuedCode{
+		challenge: qs.Get("code_challenge"),
+		idToken:   i.signRS256("rsa-1", claims),
+	}
+	i.mu.Unlock()
+
+	return code
+}
+
+// claims returns valid claims for the test client, customised by the caller.
+func (i *testIssuer) claims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":            i.server.URL,
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "ada@example.com",
+		"email_verified": true,
+	}
+}
+
+func (i *testIssuer) signRS256(kid string, claims map[string]any) string {
+	return i.signRS256With(i.rsaKey, kid, claims)
+}
+
+func (i *testIssuer) signRS256With(key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	i.t.Helper()
+
+	signingInput := i.signingInput("RS256", kid, claims)
+	hash := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (i *testIssuer) signES256(kid string, claims map[string]any) string {
+	i.t.Helper()
+
+	signingInput := i.signingInput("ES256", kid, claims)
+	hash := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, hash[:])
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (i *testIssuer) signingInput(alg, kid string, claims map[string]any) string {
+	i.t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jsonWebKey {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	return jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestExchangePKCERoundTrip(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	verifier, err := RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce-1", CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := issuer.authorize(authURL, issuer.claims(""))
+
+	claims, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if claims.Subject != "user-123" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	// A verifier that doesn't match the challenge is refused by the issuer
+	code = issuer.authorize(authURL, issuer.claims(""))
+
+	_, err = provider.Exchange(ctx, code, verifier+"x", "nonce-1")
+	if err == nil {
+		t.Error("exchange with the wrong code verifier succeeded")
+	}
+}
+
+func TestVerifySignatures(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := issuer.signRS256("rsa-1", issuer.claims("n"))
+	tampered := valid[:len(valid)-4] + "AAAA"
+
+	tests := []struct {
+		name    string
+		idToken string
+		wantErr bool
+	}{
+		{"RS256", valid, false},
+		{"ES256", issuer.signES256("ec-1", issuer.claims("n")), false},
+		{"tampered signature", tampered, true},
+		{"signed by another key", issuer.signRS256With(otherKey, "rsa-1", issuer.claims("n")), true},
+		{"RS256 header on an EC key", issuer.signRS256("ec-1", issuer.claims("n")), true},
+		{"ES256 header on an RSA key", issuer.signES256("rsa-1", issuer.claims("n")), true},
+		{"not a JWT", "abc.def", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.verify(context.Background(), tt.idToken, "n")
+			if tt.wantErr && !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v, want ErrInvalidIDToken", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+
+	tests := []struct {
+		name   string
+		modify func(map[string]any)
+	}{
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "someone-else" }},
+		{"audience list without client", func(c map[string]any) { c["aud"] = []string{"a", "b"} }},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"nonce mismatch", func(c map[string]any) { c["nonce"] = "replayed" }},
+		{"missing subject", func(c map[string]any) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims("n")
+			tt.modify(claims)
+
+			_, err := provider.verify(context.Background(), issuer.signRS256("rsa-1", claims), "n")
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	claims := issuer.claims("n")
+	claims["aud"] = []string{"other", testClientID}
+
+	_, err := provider.verify(context.Background(), issuer.signRS256("rsa-1", claims), "n")
+	if err != nil {
+		t.Errorf("audience list containing the client: %v", err)
+	}
+}
+
+func TestUnknownKeyRefreshesKeySet(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	_, err := provider.verify(ctx, issuer.signRS256("rsa-1", issuer.claims("n")), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hits := issuer.jwksHits.Load(); hits != 1 {
+		t.Fatalf("key set fetched %d times, want 1", hits)
+	}
+
+	// The provider rotates to a new key
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.publish(rsaJWK("rsa-1", &issuer.rsaKey.PublicKey), rsaJWK("rsa-2", &rotated.PublicKey))
+
+	idToken := issuer.signRS256With(rotated, "rsa-2", issuer.claims("n"))
+
+	// Refetches are rate limited, so an unknown key right after a fetch is
+	// rejected without asking the issuer again
+	_, err = provider.verify(ctx, idToken, "n")
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("got %v, want ErrUnknownKey", err)
+	}
+
+	if hits := issuer.jwksHits.Load(); hits != 1 {
+		t.Fatalf("key set fetched %d times within the refresh interval, want 1", hits)
+	}
+
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Now().Add(-keyRefreshInterval)
+	provider.mu.Unlock()
+
+	_, err = provider.verify(ctx, idToken, "n")
+	if err != nil {
+		t.Fatalf("verify with rotated key: %v", err)
+	}
+
+	if hits := issuer.jwksHits.Load(); hits != 2 {
+		t.Fatalf("key set fetched %d times, want 2", hits)
+	}
+}
+
+func TestKeyRefreshDoesNotBlockKnownKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	_, err := provider.verify(ctx, issuer.signRS256("rsa-1", issuer.claims("n")), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Time{}
+	provider.mu.Unlock()
+
+	// Hold the next key set fetch open
+	issuer.jwksGate = make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			provider.verify(ctx, issuer.signRS256("unknown", issuer.claims("n")), "n")
+		}()
+	}
+
+	// Wait for the refetch to reach the issuer
+	deadline := time.Now().Add(5 * time.Second)
+	for issuer.jwksHits.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("key set refetch never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := provider.verify(ctx, issuer.signRS256("rsa-1", issuer.claims("n")), "n")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("verify with a known key: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("verify with a known key waited on the key set fetch")
+	}
+
+	close(issuer.jwksGate)
+	wg.Wait()
+
+	// Concurrent unknown keys share a single refetch
+	if hits := issuer.jwksHits.Load(); hits != 2 {
+		t.Errorf("key set fetched %d times, want 2", hits)
+	}
+}
@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed from RFC 6238 Appendix B, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes; with 6 digits only the last 6 remain
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+
+		got, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+
+		want := tt.code[len(tt.code)-Digits:]
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, want)
+		}
+
+		matched, ok := Validate(rfcSecret, want, time.Unix(tt.unix, 0), 0)
+		if !ok || matched != step {
+			t.Errorf("Validate at %d = (%d, %t), want (%d, true)", tt.unix, matched, ok, step)
+		}
+	}
+}
+
+func TestValidateReturnsMatchedStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code, err := Code(rfcSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying a code one period later must report the step it was issued
+	// for, not the current one, so the used step check catches the reuse
+	tests := []struct {
+		name string
+		at   time.Time
+		ok   bool
+	}{
+		{"same step", now, true},
+		{"one period later", now.Add(Period * time.Second), true},
+		{"one period earlier", now.Add(-Period * time.Second), true},
+		{"outside skew", now.Add(2 * Period * time.Second), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, ok := Validate(rfcSecret, code, tt.at, 1)
+			if ok != tt.ok {
+				t.Fatalf("got ok %t, want %t", ok, tt.ok)
+			}
+
+			if ok && matched != step {
+				t.Errorf("got step %d, want %d", matched, step)
+			}
+		})
+	}
+
+	if _, ok := Validate(rfcSecret, code+"0", now, 1); ok {
+		t.Error("code with the wrong number of digits was accepted")
+	}
+}
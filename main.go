@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"flag"
+	"fmt"
+	"net/netip"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kharljhon14/starbloom-server/cmd/api"
 	"github.com/kharljhon14/starbloom-server/internal/data"
+	"github.com/kharljhon14/starbloom-server/internal/jobs"
 	"github.com/kharljhon14/starbloom-server/internal/jsonlog"
+	"github.com/kharljhon14/starbloom-server/internal/mailer"
+	"github.com/kharljhon14/starbloom-server/internal/oidc"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -18,6 +28,35 @@ func main() {
 	flag.IntVar(&cfg.Port, "port", 8080, "API server port")
 	flag.StringVar(&cfg.Env, "env", "development", "Enviroment(development|staging|production)")
 	flag.StringVar(&cfg.Db.Dsn, "DSN", os.Getenv("DSN"), "database connection string")
+
+	flag.StringVar(&cfg.Smtp.Host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host, emails are written to -mail-file when empty")
+	flag.IntVar(&cfg.Smtp.Port, "smtp-port", 587, "SMTP port")
+	flag.StringVar(&cfg.Smtp.Username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.Smtp.Password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.Smtp.Sender, "smtp-sender", "Starbloom <no-reply@starbloom.local>", "SMTP sender")
+	flag.StringVar(&cfg.MailFile, "mail-file", "", "file emails are written to when no SMTP host is set (default stdout)")
+
+	flag.StringVar(&cfg.Tokens.Format, "token-format", "opaque", "format of issued authentication tokens (opaque|signed)")
+	flag.StringVar(&cfg.Tokens.SigningKeys, "token-signing-keys", os.Getenv("TOKEN_SIGNING_KEYS"), "comma separated <key id>:<base64 secret> pairs for signed tokens")
+	flag.StringVar(&cfg.Tokens.SigningKeyID, "token-signing-key-id", "", "key id used to sign new tokens")
+
+	flag.StringVar(&cfg.Passwords.Hasher, "password-hasher", "argon2id", "algorithm for new password hashes (argon2id|bcrypt)")
+	flag.UintVar(&cfg.Passwords.Argon2Memory, "argon2-memory", uint(data.DefaultArgon2idHasher.Memory), "argon2id memory in KiB")
+	flag.UintVar(&cfg.Passwords.Argon2Iterations, "argon2-iterations", uint(data.DefaultArgon2idHasher.Iterations), "argon2id iterations")
+	flag.UintVar(&cfg.Passwords.Argon2Parallelism, "argon2-parallelism", uint(data.DefaultArgon2idHasher.Parallelism), "argon2id parallelism")
+	flag.IntVar(&cfg.Passwords.BcryptCost, "bcrypt-cost", 12, "bcrypt cost")
+
+	flag.DurationVar(&cfg.AuthCache.TTL, "auth-cache-ttl", 30*time.Second, "how long authenticated tokens are cached in memory, and so how long a revoked token can still work on other instances (0 disables the cache)")
+	flag.IntVar(&cfg.AuthCache.Size, "auth-cache-size", 10000, "maximum number of cached authenticated tokens")
+
+	flag.DurationVar(&cfg.DeletionGracePeriod, "deletion-grace-period", 30*24*time.Hour, "how long deleted accounts can be restored before being purged")
+
+	flag.DurationVar(&cfg.Usernames.ChangeCooldown, "username-change-cooldown", 30*24*time.Hour, "minimum time between username changes")
+	flag.DurationVar(&cfg.Usernames.HoldPeriod, "username-hold-period", 90*24*time.Hour, "how long a retired username redirects to its previous owner before it can be claimed")
+
+	flag.StringVar(&cfg.OIDCConfigFile, "oidc-config", os.Getenv("OIDC_CONFIG"), "JSON file listing OpenID Connect providers")
+
+	flag.StringVar(&cfg.TrustedProxies, "trusted-proxies", os.Getenv("TRUSTED_PROXIES"), "comma separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For is trusted")
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -30,18 +69,72 @@ func main() {
 
 	logger.PrintInfo("database connection pool establised", nil)
 
+	mail, err := openMailer(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	hasher, err := openPasswordHasher(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	data.SetPasswordHasher(hasher)
+
+	models := data.NewModels(db)
+
+	signer, err := openTokenSigner(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	if cfg.Tokens.Format == "signed" {
+		models.Tokens.Signer = signer
+	}
+
+	models.Tokens.Cache = data.NewAuthCache(cfg.AuthCache.TTL, cfg.AuthCache.Size)
+
+	expvar.Publish("auth_cache", expvar.Func(func() any {
+		return models.Tokens.Cache.Stats()
+	}))
+
+	providers, err := openOIDCProviders(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &api.Application{
-		Config: cfg,
-		Logger: logger,
-		Models: data.NewModels(db),
+		Config:         cfg,
+		Logger:         logger,
+		Models:         models,
+		Mailer:         mail,
+		Signer:         signer,
+		OIDCProviders:  providers,
+		TrustedProxies: trustedProxies,
 	}
 
+	runner := jobs.New(logger, app.Jobs()...)
+	runner.Start()
+
 	mux := app.Mount()
 
 	err = app.Serve(mux)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
+
+	runner.Stop()
+
+	// Persist last-used times buffered since the final scheduled flush
+	err = models.Sessions.Flush()
+	if err != nil {
+		logger.PrintError(err.Error(), nil)
+	}
 }
 
 func openDb(cfg api.Config) (*pgxpool.Pool, error) {
@@ -52,3 +145,124 @@ func openDb(cfg api.Config) (*pgxpool.Pool, error) {
 
 	return db, nil
 }
+
+func openMailer(cfg api.Config) (mailer.Mailer, error) {
+	if cfg.Smtp.Host != "" {
+		return mailer.NewSMTP(
+			cfg.Smtp.Host,
+			cfg.Smtp.Port,
+			cfg.Smtp.Username,
+			cfg.Smtp.Password,
+			cfg.Smtp.Sender,
+		), nil
+	}
+
+	if cfg.MailFile == "" {
+		return mailer.NewWriter(os.Stdout, cfg.Smtp.Sender), nil
+	}
+
+	f, err := os.OpenFile(cfg.MailFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return mailer.NewWriter(f, cfg.Smtp.Sender), nil
+}
+
+// parseTrustedProxies reads a comma separated list of addresses and CIDR
+// ranges. A bare address is a range of one.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("trusted-proxies: %w", err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("trusted-proxies: %w", err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func openTokenSigner(cfg api.Config) (*data.TokenSigner, error) {
+	switch cfg.Tokens.Format {
+	case "opaque", "signed":
+	default:
+		return nil, errors.New("token-format must be opaque or signed")
+	}
+
+	if cfg.Tokens.SigningKeys == "" {
+		if cfg.Tokens.Format == "signed" {
+			return nil, errors.New("token-signing-keys is required for signed tokens")
+		}
+		return nil, nil
+	}
+
+	keys, err := data.ParseSigningKeys(cfg.Tokens.SigningKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.NewTokenSigner(keys, cfg.Tokens.SigningKeyID)
+}
+
+func openPasswordHasher(cfg api.Config) (data.PasswordHasher, error) {
+	switch cfg.Passwords.Hasher {
+	case "argon2id":
+		if cfg.Passwords.Argon2Memory == 0 || cfg.Passwords.Argon2Iterations == 0 ||
+			cfg.Passwords.Argon2Parallelism == 0 || cfg.Passwords.Argon2Parallelism > 255 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+
+		hasher := data.DefaultArgon2idHasher
+		hasher.Memory = uint32(cfg.Passwords.Argon2Memory)
+		hasher.Iterations = uint32(cfg.Passwords.Argon2Iterations)
+		hasher.Parallelism = uint8(cfg.Passwords.Argon2Parallelism)
+
+		return hasher, nil
+	case "bcrypt":
+		if cfg.Passwords.BcryptCost < bcrypt.MinCost || cfg.Passwords.BcryptCost > bcrypt.MaxCost {
+			return nil, errors.New("invalid bcrypt cost")
+		}
+
+		return data.BcryptHasher{Cost: cfg.Passwords.BcryptCost}, nil
+	default:
+		return nil, errors.New("password-hasher must be argon2id or bcrypt")
+	}
+}
+
+func openOIDCProviders(cfg api.Config) (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider)
+
+	if cfg.OIDCConfigFile == "" {
+		return providers, nil
+	}
+
+	configs, err := oidc.LoadProviders(cfg.OIDCConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, providerConfig := range configs {
+		providers[providerConfig.Name] = oidc.NewProvider(providerConfig)
+	}
+
+	return providers, nil
+}
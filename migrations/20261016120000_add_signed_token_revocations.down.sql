@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS tokens_revoke_signed ON tokens;
+DROP FUNCTION IF EXISTS revoke_signed_token();
+DROP TABLE IF EXISTS revoked_tokens;
+
+ALTER TABLE tokens DROP COLUMN IF EXISTS signed;
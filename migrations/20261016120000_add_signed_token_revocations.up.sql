@@ -0,0 +1,24 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS signed boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    hash bytea PRIMARY KEY,
+    expired_at timestamp(0) with time zone NOT NULL
+);
+
+-- Signed tokens are validated without reading the tokens table, so deleting
+-- one has to leave a record behind until it would have expired anyway
+CREATE OR REPLACE FUNCTION revoke_signed_token() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO revoked_tokens (hash, expired_at)
+    VALUES (OLD.hash, OLD.expired_at)
+    ON CONFLICT (hash) DO NOTHING;
+
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tokens_revoke_signed
+AFTER DELETE ON tokens
+FOR EACH ROW
+WHEN (OLD.signed AND OLD.expired_at > NOW())
+EXECUTE FUNCTION revoke_signed_token();
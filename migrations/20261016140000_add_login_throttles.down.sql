@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+
+DROP TABLE IF EXISTS login_throttles;
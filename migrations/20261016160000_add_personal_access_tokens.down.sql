@@ -0,0 +1,3 @@
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS permissions,
+    DROP COLUMN IF EXISTS name;
@@ -0,0 +1,3 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS name text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS permissions text[] NOT NULL DEFAULT '{}';
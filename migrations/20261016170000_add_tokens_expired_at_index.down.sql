@@ -0,0 +1 @@
+DROP INDEX IF EXISTS tokens_expired_at_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS tokens_expired_at_idx ON tokens (expired_at);
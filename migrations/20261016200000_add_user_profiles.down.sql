@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS website,
+    DROP COLUMN IF EXISTS bio;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS bio text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS website text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
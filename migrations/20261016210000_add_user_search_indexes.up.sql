@@ -0,0 +1,9 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Trigram indexes serve both the prefix (LIKE 'q%') and similarity (%)
+-- conditions of user search
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx
+ON users USING gin (lower(username) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS users_full_name_trgm_idx
+ON users USING gin (lower(first_name || ' ' || last_name) gin_trgm_ops);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    blocked_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS blocks_blocked_id_idx ON blocks (blocked_id);
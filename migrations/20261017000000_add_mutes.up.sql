@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS muted_users (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    muted_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone,
+    PRIMARY KEY (user_id, muted_id),
+    CHECK (user_id <> muted_id)
+);
+
+CREATE TABLE IF NOT EXISTS muted_keywords (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    keyword text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone,
+    UNIQUE (user_id, keyword)
+);
+
+CREATE INDEX IF NOT EXISTS muted_users_expires_at_idx ON muted_users (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS muted_keywords_expires_at_idx ON muted_keywords (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS username_history (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    username text NOT NULL,
+    retired_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    held_until timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS username_history_username_idx ON username_history (username, held_until);
+CREATE INDEX IF NOT EXISTS username_history_user_id_idx ON username_history (user_id);
+CREATE INDEX IF NOT EXISTS username_history_held_until_idx ON username_history (held_until);
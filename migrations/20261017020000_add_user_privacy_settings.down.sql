@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS show_created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS show_website;
+ALTER TABLE users DROP COLUMN IF EXISTS show_bio;
+ALTER TABLE users DROP COLUMN IF EXISTS show_email;
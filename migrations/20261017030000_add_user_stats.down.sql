@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS likes_user_stats ON likes;
+DROP TRIGGER IF EXISTS posts_user_stats_delete ON posts;
+DROP TRIGGER IF EXISTS posts_user_stats_insert ON posts;
+DROP TRIGGER IF EXISTS follows_user_stats ON follows;
+DROP TRIGGER IF EXISTS users_user_stats ON users;
+
+DROP FUNCTION IF EXISTS user_stats_likes();
+DROP FUNCTION IF EXISTS user_stats_posts();
+DROP FUNCTION IF EXISTS user_stats_follows();
+DROP FUNCTION IF EXISTS user_stats_users();
+
+DROP TABLE IF EXISTS user_stats;
@@ -0,0 +1,90 @@
+-- Profile counters are kept up to date by triggers so reading a profile
+-- never has to count follows, posts or likes.
+CREATE TABLE IF NOT EXISTS user_stats (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    followers_count bigint NOT NULL DEFAULT 0,
+    following_count bigint NOT NULL DEFAULT 0,
+    posts_count bigint NOT NULL DEFAULT 0,
+    likes_received_count bigint NOT NULL DEFAULT 0
+);
+
+INSERT INTO user_stats (user_id, followers_count, following_count, posts_count, likes_received_count)
+SELECT
+    u.id,
+    (SELECT count(*) FROM follows f WHERE f.user_id = u.id),
+    (SELECT count(*) FROM follows f WHERE f.follower_id = u.id),
+    (SELECT count(*) FROM posts p WHERE p.user_id = u.id),
+    (SELECT count(*) FROM likes l INNER JOIN posts p ON p.id = l.post_id WHERE p.user_id = u.id)
+FROM users u
+ON CONFLICT (user_id) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION user_stats_users() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO user_stats (user_id) VALUES (NEW.id) ON CONFLICT (user_id) DO NOTHING;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION user_stats_follows() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE user_stats SET followers_count = followers_count + 1 WHERE user_id = NEW.user_id;
+        UPDATE user_stats SET following_count = following_count + 1 WHERE user_id = NEW.follower_id;
+    ELSE
+        UPDATE user_stats SET followers_count = followers_count - 1 WHERE user_id = OLD.user_id;
+        UPDATE user_stats SET following_count = following_count - 1 WHERE user_id = OLD.follower_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Runs before the delete so the post's remaining likes can still be counted.
+-- Likes removed along with the post no longer find it and leave the
+-- counters alone.
+CREATE OR REPLACE FUNCTION user_stats_posts() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE user_stats SET posts_count = posts_count + 1 WHERE user_id = NEW.user_id;
+        RETURN NULL;
+    END IF;
+
+    UPDATE user_stats
+    SET posts_count = posts_count - 1,
+        likes_received_count = likes_received_count - (SELECT count(*) FROM likes WHERE post_id = OLD.id)
+    WHERE user_id = OLD.user_id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION user_stats_likes() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE user_stats SET likes_received_count = likes_received_count + 1
+        WHERE user_id = (SELECT user_id FROM posts WHERE id = NEW.post_id);
+    ELSE
+        UPDATE user_stats SET likes_received_count = likes_received_count - 1
+        WHERE user_id = (SELECT user_id FROM posts WHERE id = OLD.post_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_user_stats ON users;
+CREATE TRIGGER users_user_stats AFTER INSERT ON users
+FOR EACH ROW EXECUTE FUNCTION user_stats_users();
+
+DROP TRIGGER IF EXISTS follows_user_stats ON follows;
+CREATE TRIGGER follows_user_stats AFTER INSERT OR DELETE ON follows
+FOR EACH ROW EXECUTE FUNCTION user_stats_follows();
+
+DROP TRIGGER IF EXISTS posts_user_stats_insert ON posts;
+CREATE TRIGGER posts_user_stats_insert AFTER INSERT ON posts
+FOR EACH ROW EXECUTE FUNCTION user_stats_posts();
+
+DROP TRIGGER IF EXISTS posts_user_stats_delete ON posts;
+CREATE TRIGGER posts_user_stats_delete BEFORE DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION user_stats_posts();
+
+DROP TRIGGER IF EXISTS likes_user_stats ON likes;
+CREATE TRIGGER likes_user_stats AFTER INSERT OR DELETE ON likes
+FOR EACH ROW EXECUTE FUNCTION user_stats_likes();
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS user_stats_followers_count_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS user_stats_followers_count_idx ON user_stats (followers_count DESC);
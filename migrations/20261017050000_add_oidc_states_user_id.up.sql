@@ -0,0 +1 @@
+ALTER TABLE oidc_states ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE CASCADE;
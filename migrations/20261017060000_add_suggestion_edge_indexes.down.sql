@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS likes_user_id_created_at_idx;
+DROP INDEX IF EXISTS likes_post_id_created_at_idx;
+DROP INDEX IF EXISTS follows_follower_id_created_at_idx;
@@ -0,0 +1,10 @@
+-- Suggestions read the most recent follows of each followed account and
+-- the most recent likes of each liked post
+CREATE INDEX IF NOT EXISTS follows_follower_id_created_at_idx
+ON follows (follower_id, created_at DESC, user_id);
+
+CREATE INDEX IF NOT EXISTS likes_post_id_created_at_idx
+ON likes (post_id, created_at DESC, user_id);
+
+CREATE INDEX IF NOT EXISTS likes_user_id_created_at_idx
+ON likes (user_id, created_at DESC);
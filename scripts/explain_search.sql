@@ -0,0 +1,85 @@
+-- Seeds a million users in a transaction, explains user search against
+-- them and rolls everything back. Run against a migrated database with
+--
+--     make explainsearch
+--
+-- The prepared statement below must be kept in step with UserModel.Search.
+
+BEGIN;
+
+INSERT INTO users (username, email, first_name, last_name, hashed_password, activated)
+SELECT
+    lower(first_name) || '_' || substr(md5(g::text), 1, 8),
+    'seed' || g || '@example.com',
+    first_name,
+    last_name,
+    '\x00'::bytea,
+    true
+FROM generate_series(1, 1000000) g,
+LATERAL (
+    SELECT
+        (ARRAY['Ada', 'Alan', 'Grace', 'Linus', 'Margaret', 'Dennis', 'Barbara', 'Ken',
+               'Frances', 'Edsger', 'Radia', 'Donald', 'Katherine', 'John', 'Annie',
+               'Tim', 'Hedy', 'Niklaus', 'Sophie', 'Guido'])[1 + g % 20] AS first_name,
+        (ARRAY['Lovelace', 'Turing', 'Hopper', 'Torvalds', 'Hamilton', 'Ritchie',
+               'Liskov', 'Thompson', 'Allen', 'Dijkstra', 'Perlman', 'Knuth', 'Johnson',
+               'McCarthy', 'Easley', 'Berners-Lee', 'Lamarr', 'Wirth', 'Wilson',
+               'van Rossum'])[1 + (g / 20) % 20] AS last_name
+) names;
+
+ANALYZE users;
+
+PREPARE search(text, bigint, text, int, int) AS
+	WITH candidates AS (
+		SELECT id FROM users WHERE lower(username) = $1
+		UNION
+		(SELECT f.user_id FROM follows f
+		INNER JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $2
+		AND (lower(u.username) LIKE $3 OR lower(u.first_name || ' ' || u.last_name) LIKE $3)
+		LIMIT 500)
+		UNION
+		(SELECT id FROM users WHERE lower(username) LIKE $3 LIMIT 500)
+		UNION
+		(SELECT id FROM users WHERE lower(first_name || ' ' || last_name) LIKE $3 LIMIT 500)
+		UNION
+		(SELECT id FROM users WHERE lower(username) % $1 LIMIT 500)
+		UNION
+		(SELECT id FROM users WHERE lower(first_name || ' ' || last_name) % $1 LIMIT 500)
+	),
+	matches AS (
+		SELECT u.id, u.username, u.first_name, u.last_name, u.avatar_url,
+		f.follower_id IS NOT NULL AS followed
+		FROM candidates c
+		INNER JOIN users u ON u.id = c.id
+		LEFT JOIN follows f ON f.user_id = u.id AND f.follower_id = $2
+		WHERE u.deletion_requested_at IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = u.id AND b.blocked_id = $2)
+			OR (b.blocker_id = $2 AND b.blocked_id = u.id)
+		)
+	)
+	SELECT (SELECT count(*) FROM matches), id, username, first_name, last_name, avatar_url, followed
+	FROM matches
+	ORDER BY
+		lower(username) = $1 DESC,
+		followed DESC,
+		lower(username) LIKE $3 DESC,
+		GREATEST(
+			similarity(lower(username), $1),
+			similarity(lower(first_name || ' ' || last_name), $1)
+		) DESC,
+		id
+	LIMIT $4 OFFSET $5;
+
+-- A common prefix, a rare one and a typo, as the first page a client asks for
+EXPLAIN (ANALYZE, BUFFERS) EXECUTE search('gra', 1, 'gra%', 20, 0);
+EXPLAIN (ANALYZE, BUFFERS) EXECUTE search('ada_0f1e', 1, 'ada\_0f1e%', 20, 0);
+EXPLAIN (ANALYZE, BUFFERS) EXECUTE search('dijstra', 1, 'dijstra%', 20, 0);
+
+-- The plan pgx ends up reusing once Postgres switches to a generic plan
+SET LOCAL plan_cache_mode = force_generic_plan;
+EXPLAIN (ANALYZE, BUFFERS) EXECUTE search('gra', 1, 'gra%', 20, 0);
+
+ROLLBACK;